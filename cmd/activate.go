@@ -1,36 +1,52 @@
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/ekalinin/pbvm/utils"
 	"github.com/spf13/cobra"
 )
 
 // activateCmd represents the activate command
 var activateCmd = &cobra.Command{
-	Use:   "activate <version>",
+	Use:   "activate [<version>]",
 	Short: "Activate version",
-	Long:  `Activate version. Version should be installed.`,
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		version := args[0]
-		installed, _, err := utils.IsInstalledVersion(pbName, version)
+	Long: `Activate version. Version should be installed.
+
+Version could be an exact tag (v3.12.3) or a constraint resolved against
+installed versions: latest, stable, 3.x, ~3.12, ">=3.19 <4", etc. Without
+a version "default-version" config key is used.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		constraint, err := defaultVersion(args)
 		if err != nil {
-			panic(err)
+			return err
 		}
-		if !installed {
-			fmt.Printf("Version %s is not installed.\n"+
-				"Please, run: '%s install %[1]s'\n",
-				version, pbName)
-			return
+		version, err := utils.ResolveInstalledVersion(pbName, constraint)
+		if err != nil {
+			return err
 		}
-		if err := utils.ActivateVersion(pbName, version); err != nil {
-			panic(err)
+		installed, versionDir, err := utils.IsInstalledVersion(pbName, version)
+		if err != nil {
+			return err
 		}
+		if !installed || !adoptInstall(version, versionDir) {
+			return utils.NewError(utils.ErrNotInstalled,
+				"Version %s is not installed. Please, run: '%s install %[1]s'",
+				version, pbName)
+		}
+		return activate(version)
 	},
 }
 
+// activate activates an installed version under the global lock
+func activate(version string) error {
+	unlock, err := acquireLock(utils.ActiveLockName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return utils.ActivateVersion(pbName, version)
+}
+
 func init() {
 	rootCmd.AddCommand(activateCmd)
 }
@@ -0,0 +1,477 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ekalinin/pbvm/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// Kinds of config values
+const (
+	kindString   = "string"
+	kindBool     = "bool"
+	kindDuration = "duration"
+	kindMap      = "map"
+)
+
+// configKey is a documented config key
+type configKey struct {
+	name string
+	kind string
+	// flag is a name of the persistent flag set by the key (if any)
+	flag string
+	// project is true if the key could be set by the project config (keys
+	// redirecting downloads, credentials or home are not trusted there)
+	project bool
+	desc    string
+}
+
+// configKeys is the config schema
+var configKeys = []configKey{
+	{"default-version", kindString, "", true, "version installed/activated if it is not passed"},
+	{"source", kindString, "source", false, "release source: github, GitHub compatible API URL (mirror) or local directory"},
+	{"github-token", kindString, "", false, "GitHub API token"},
+	{"proxy", kindString, "", false, "HTTP(S) proxy URL (overrides HTTP_PROXY/HTTPS_PROXY)"},
+	{"cache-ttl", kindDuration, "cache-ttl", true, "time while cached release metadata is used without revalidation"},
+	{"wait-rate-limit", kindDuration, "wait-rate-limit", true, "max time to wait for GitHub API rate limit reset"},
+	{"lock-timeout", kindDuration, "lock-timeout", true, "max time to wait for a lock held by another process"},
+	{"home", kindString, "", false, "home dir (default is ~/." + pbName + ")"},
+	{"xdg", kindBool, "", false, "split home into XDG base dirs (if home is not set)"},
+	{"output", kindString, "output", true, "output format: " + strings.Join(outputFormats, ", ")},
+	{"prerelease", kindBool, "", true, "version constraints (except \"stable\") match pre-releases"},
+	{"plugins", kindMap, "", true, "default version constraints of plugins (<name>: <constraint>)"},
+}
+
+// userConfig and projectConfig are keys of the user and the project config
+// files (for origins of values)
+var userConfig = map[string]interface{}{}
+var projectConfig = map[string]interface{}{}
+
+// projectConfigFile is a path of the project's config (empty if not found)
+var projectConfigFile string
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage configuration",
+	Long: `Manage configuration.
+
+Settings are taken from (the first wins):
+
+  - command line flags
+  - environment variables (` + strings.ToUpper(pbName) + `_<KEY>, e.g. ` + strings.ToUpper(pbName) + `_CACHE_TTL)
+  - the project config (.` + pbName + `.yaml in the current directory or its parents)
+  - the user config (~/.` + pbName + `.yaml or --config)
+
+Keys marked with * are ignored in the project config: a cloned repository
+should not redirect downloads, credentials or home dir.
+
+Known keys:
+
+` + configKeysHelp(),
+}
+
+// configGetCmd represents the config get command
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print a config value",
+	Long:  `Print an effective value of a config key (plugins.<name> for a plugin).`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		k, err := findConfigKey(args[0])
+		if err != nil {
+			return err
+		}
+		if k.kind == kindMap && k.name == args[0] {
+			m := viper.GetStringMapString(k.name)
+			for _, name := range sortedKeys(m) {
+				fmt.Printf("%s=%s\n", name, m[name])
+			}
+			return nil
+		}
+		fmt.Println(configValue(k, args[0]))
+		return nil
+	},
+}
+
+// configSetCmd represents the config set command
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a config value",
+	Long:  `Set a value in the user config (plugins.<name> for a plugin).`,
+	Example: `  ` + pbName + ` config set cache-ttl 24h
+  ` + pbName + ` config set plugins.protoc-gen-go v1.25.0`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		k, err := findConfigKey(args[0])
+		if err != nil {
+			return err
+		}
+		value, err := parseConfigValue(k, args[0], args[1])
+		if err != nil {
+			return err
+		}
+
+		file, err := userConfigFile()
+		if err != nil {
+			return err
+		}
+		cfg, err := readConfigFile(file)
+		if err != nil {
+			return err
+		}
+		if k.kind == kindMap {
+			m, _ := cfg[k.name].(map[interface{}]interface{})
+			if m == nil {
+				m = map[interface{}]interface{}{}
+			}
+			m[strings.TrimPrefix(args[0], k.name+".")] = value
+			cfg[k.name] = m
+		} else {
+			cfg[k.name] = value
+		}
+
+		data, err := yaml.Marshal(cfg)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(file, data, 0644)
+	},
+}
+
+// configListCmd represents the config list command
+var configListCmd = &cobra.Command{
+	Aliases: []string{"ls"},
+	Use:     "list",
+	Short:   "List config values",
+	Long:    `Shows effective values of all config keys and where they come from.`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, k := range configKeys {
+			if k.kind != kindMap {
+				fmt.Printf("%-24s %-32s %s\n", k.name, configValue(k, k.name), configOrigin(k, k.name))
+				continue
+			}
+			m := viper.GetStringMapString(k.name)
+			for _, name := range sortedKeys(m) {
+				key := k.name + "." + name
+				fmt.Printf("%-24s %-32s %s\n", key, m[name], configOrigin(k, key))
+			}
+		}
+		return nil
+	},
+}
+
+// configEditCmd represents the config edit command
+var configEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit the user config",
+	Long:  `Open the user config in $VISUAL or $EDITOR.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := userConfigFile()
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+				return err
+			}
+		}
+
+		editor := strings.Fields(os.Getenv("VISUAL"))
+		if len(editor) == 0 {
+			editor = strings.Fields(os.Getenv("EDITOR"))
+		}
+		if len(editor) == 0 {
+			editor = []string{"vi"}
+			if runtime.GOOS == "windows" {
+				editor = []string{"notepad"}
+			}
+		}
+		c := exec.Command(editor[0], append(editor[1:], file)...)
+		c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := c.Run(); err != nil {
+			return err
+		}
+		_, err = readConfigFile(file)
+		return err
+	},
+}
+
+// configKeysHelp returns a description of known keys
+func configKeysHelp() string {
+	var b strings.Builder
+	for _, k := range configKeys {
+		name := k.name
+		if !k.project {
+			name += " *"
+		}
+		fmt.Fprintf(&b, "  %-16s %s\n", name, k.desc)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// findConfigKey returns a key of the schema (plugins.<name> belongs to
+// "plugins")
+func findConfigKey(name string) (configKey, error) {
+	for _, k := range configKeys {
+		if k.name == name || k.kind == kindMap && strings.HasPrefix(name, k.name+".") {
+			return k, nil
+		}
+	}
+	return configKey{}, errors.New("Unknown config key: " + name +
+		" (see \"" + pbName + " config --help\")")
+}
+
+// parseConfigValue validates a value of a key
+func parseConfigValue(k configKey, name, value string) (interface{}, error) {
+	switch k.kind {
+	case kindBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("Value of %s should be true or false: %s", name, value)
+		}
+		return b, nil
+	case kindDuration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("Value of %s should be a duration (1h, 30m): %s", name, value)
+		}
+	case kindMap:
+		if name == k.name {
+			return nil, fmt.Errorf("Set %s.<name> instead of %s", k.name, k.name)
+		}
+	}
+	if k.name == "output" {
+		if err := checkOutputFormat(value); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// configValue returns an effective value of a key (flags are set from
+// the config already, see applyConfig)
+func configValue(k configKey, name string) string {
+	switch {
+	case k.flag != "":
+		return rootCmd.PersistentFlags().Lookup(k.flag).Value.String()
+	case k.kind == kindBool:
+		return strconv.FormatBool(viper.GetBool(name))
+	case k.name == "github-token" && viper.GetString(name) != "":
+		// do not show secrets
+		return "***"
+	}
+	return viper.GetString(name)
+}
+
+// configOrigin returns where a value of a key comes from
+func configOrigin(k configKey, name string) string {
+	if k.flag != "" && rootCmd.PersistentFlags().Lookup(k.flag).Changed {
+		return "flag"
+	}
+	if _, ok := os.LookupEnv(configEnvName(name)); ok && k.kind != kindMap {
+		return "env"
+	}
+	if hasConfigKey(projectConfig, name) {
+		return projectConfigFile
+	}
+	if hasConfigKey(userConfig, name) {
+		return viper.ConfigFileUsed()
+	}
+	return "default"
+}
+
+// hasConfigKey returns true if a (dotted) key is set in a config
+func hasConfigKey(cfg map[string]interface{}, name string) bool {
+	parts := strings.SplitN(name, ".", 2)
+	v, ok := cfg[parts[0]]
+	if !ok || len(parts) == 1 {
+		return ok
+	}
+	switch m := v.(type) {
+	case map[interface{}]interface{}:
+		_, ok = m[parts[1]]
+	case map[string]interface{}:
+		_, ok = m[parts[1]]
+	default:
+		ok = false
+	}
+	return ok
+}
+
+// configEnvName returns a name of the env variable for a key
+func configEnvName(name string) string {
+	return strings.ToUpper(pbName + "_" + strings.Replace(name, "-", "_", -1))
+}
+
+// loadProjectConfig merges the project's config (if any) over the user one
+func loadProjectConfig() error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	file, err := utils.FindProjectConfig(pbName, cwd)
+	if err != nil || file == "" {
+		return err
+	}
+	if used := viper.ConfigFileUsed(); used != "" && sameFile(file, used) {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	cfg := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("Config %s is broken: %v", file, err)
+	}
+	projectConfig = map[string]interface{}{}
+	names := make([]string, 0, len(cfg))
+	for name := range cfg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := cfg[name]
+		if k, err := findConfigKey(name); err == nil && !k.project {
+			fmt.Fprintf(os.Stderr, "Warning: config key %s is ignored in %s (set it in the user config)\n",
+				name, file)
+			continue
+		}
+		projectConfig[name] = value
+	}
+	if err := viper.MergeConfigMap(projectConfig); err != nil {
+		return fmt.Errorf("Config %s is broken: %v", file, err)
+	}
+	projectConfigFile = file
+	return nil
+}
+
+// applyConfig sets flags (not set in the command line) and global settings
+// from the config
+func applyConfig() error {
+	for _, k := range configKeys {
+		if k.flag == "" || !viper.IsSet(k.name) {
+			continue
+		}
+		f := rootCmd.PersistentFlags().Lookup(k.flag)
+		if f.Changed {
+			continue
+		}
+		if err := f.Value.Set(viper.GetString(k.name)); err != nil {
+			return fmt.Errorf("Config key %s is incorrect: %v", k.name, err)
+		}
+	}
+
+	utils.SetHome(viper.GetString("home"), viper.GetBool("xdg"))
+	utils.IncludePrereleases = viper.GetBool("prerelease")
+	// env is used by child processes ("go install") too
+	if proxy := viper.GetString("proxy"); proxy != "" {
+		for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"} {
+			os.Setenv(name, proxy)
+		}
+	}
+	return nil
+}
+
+// userConfigFile returns a path of the user config
+func userConfigFile() (string, error) {
+	if cfgFile != "" {
+		return cfgFile, nil
+	}
+	if used := viper.ConfigFileUsed(); used != "" && !sameFile(used, projectConfigFile) {
+		return used, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return home + string(os.PathSeparator) + "." + pbName + ".yaml", nil
+}
+
+// readConfigFile reads a yaml config (empty if the file does not exist)
+func readConfigFile(file string) (map[string]interface{}, error) {
+	cfg := map[string]interface{}{}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("Config %s is broken: %v", file, err)
+	}
+	if cfg == nil {
+		cfg = map[string]interface{}{}
+	}
+	return cfg, nil
+}
+
+// defaultVersion returns a version from args or "default-version" key
+func defaultVersion(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	if v := viper.GetString("default-version"); v != "" {
+		d("Using default version:", v)
+		return v, nil
+	}
+	return "", errors.New("Version is not set (pass it or set \"default-version\" config key)")
+}
+
+// pluginConstraint returns a version constraint of a plugin spec
+// (name[@version]), a default one is taken from "plugins" key
+func pluginConstraint(spec string) (string, string) {
+	name, constraint := utils.ParsePluginSpec(spec)
+	if !strings.Contains(spec, "@") {
+		if c := viper.GetStringMapString("plugins")[name]; c != "" {
+			d("Using default version of", name, ":", c)
+			constraint = c
+		}
+	}
+	return name, constraint
+}
+
+func sortedKeys(m map[string]string) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func sameFile(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	sa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	sb, err := os.Stat(b)
+	return err == nil && os.SameFile(sa, sb)
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configEditCmd)
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/ekalinin/pbvm/utils"
+	"github.com/spf13/cobra"
+)
+
+// currentCmd represents the current command
+var currentCmd = &cobra.Command{
+	Use:   "current",
+	Short: "Show version used in the current directory",
+	Long: `Show version used in the current directory and where it is set.
+
+See "` + pbName + ` run --help" for the resolution order.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version, origin, err := utils.ResolveVersion(pbName, "")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s (set by %s)\n", version, origin)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(currentCmd)
+}
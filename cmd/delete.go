@@ -2,46 +2,82 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
+	"os"
 
 	"github.com/ekalinin/pbvm/utils"
 	"github.com/spf13/cobra"
 )
 
+var deleteYes bool
+
 // deleteCmd represents the delete command
 var deleteCmd = &cobra.Command{
 	Aliases: []string{"rm"},
 	Use:     "delete <version>",
 	Short:   "Delete version",
-	Long:    `Delete version. Version should be installed.`,
-	Args:    cobra.ExactArgs(1),
+	Long: `Delete version. Version should be installed.
+
+A version constraint (3.x, latest, etc) is resolved against installed
+versions, the resolved version is deleted only with --yes.`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		version := args[0]
-		installed, _, err := utils.IsInstalledVersion(pbName, version)
+		c, err := utils.ParseConstraint(args[0])
 		if err != nil {
 			return err
 		}
-		if !installed {
-			// suppress help output
-			// https://github.com/spf13/cobra/issues/340
-			cmd.SilenceUsage = true
-			cmd.SilenceErrors = true
-			return errors.New("Version " + version + " is not installed")
-		}
-		active, err := utils.IsActiveVersion(pbName, version)
+		version, err := utils.ResolveInstalledVersion(pbName, args[0])
 		if err != nil {
 			return err
 		}
-		if active {
-			// suppress help output
-			cmd.SilenceUsage = true
-			cmd.SilenceErrors = true
-			return errors.New("Version " + version + " is active at the moment")
+		if _, exact := c.Exact(); !exact {
+			if !deleteYes {
+				return fmt.Errorf("%s matches %s, run with --yes to delete it", args[0], version)
+			}
+			fmt.Fprintln(os.Stderr, "Deleting", version)
+		}
+		unlock, err := acquireLock(utils.GetVersionLockName(version))
+		if err != nil {
+			return err
 		}
+		defer unlock()
 
-		return utils.DeleteVersion(pbName, version)
+		state, _, err := utils.GetInstallState(pbName, version)
+		if err != nil {
+			return err
+		}
+		if state == utils.NotInstalled {
+			return utils.NewError(utils.ErrNotInstalled, "Version %s is not installed", version)
+		}
+		if err := deleteInactive(version); err != nil {
+			return err
+		}
+		return rehash()
 	},
 }
 
+// deleteInactive deletes a version if it is not active (under the global
+// lock, so the version could not be activated meanwhile)
+func deleteInactive(version string) error {
+	unlock, err := acquireLock(utils.ActiveLockName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	active, err := utils.IsActiveVersion(pbName, version)
+	if err != nil {
+		return err
+	}
+	if active {
+		return errors.New("Version " + version + " is active at the moment")
+	}
+	return utils.DeleteVersion(pbName, version)
+}
+
 func init() {
 	rootCmd.AddCommand(deleteCmd)
+
+	deleteCmd.Flags().BoolVarP(&deleteYes, "yes", "y", false,
+		"Delete a version resolved from a constraint")
 }
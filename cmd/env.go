@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ekalinin/pbvm/utils"
+	"github.com/spf13/cobra"
+)
+
+var envShell string
+var envHook bool
+
+// envCmd represents the env command
+var envCmd = &cobra.Command{
+	Use:   "env [<version>]",
+	Short: "Print shell environment for a version",
+	Long: `Print shell commands which prepare the current shell for a version:
+version's bin dir is prepended to PATH (bin dirs of other versions are
+removed), ` + utils.EnvProtoc + ` and ` + utils.EnvProtocInclude + ` are set. Unlike "` + pbName + ` shell"
+` + utils.GetVersionEnvName(pbName) + ` is not set, so pinned versions still win in other directories.
+
+Version could be an exact tag or a constraint resolved against installed
+versions. Without a version the one resolved for the current directory is
+used (see "` + pbName + ` run --help"). Shell is detected by $SHELL, supported
+shells: ` + strings.Join(utils.Shells, ", ") + `.`,
+	Example: `  eval "$(` + pbName + ` env v3.12.3)"
+  ` + pbName + ` env 3.x --shell fish | source
+  ` + pbName + ` env 3.x --shell powershell | Out-String | Invoke-Expression`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		shell, err := utils.ParseShell(envShell)
+		if err != nil {
+			return err
+		}
+		if envHook {
+			if len(args) > 0 {
+				return errors.New("Version could not be set with --hook")
+			}
+			return printHookEnv(shell)
+		}
+		explicit := ""
+		if len(args) > 0 {
+			explicit = args[0]
+		}
+		version, err := resolveInstalled(explicit)
+		if err != nil {
+			return err
+		}
+
+		lines, err := utils.ShellHookEnv(pbName, version, shell)
+		if err != nil {
+			return err
+		}
+		for _, l := range lines {
+			fmt.Println(l)
+		}
+		return nil
+	},
+}
+
+// printHookEnv prints env for the version resolved in the current directory
+// (used by the auto-switch hook of "init"). If there is no such version,
+// protoc is removed from the env.
+func printHookEnv(shell string) error {
+	version, err := resolveInstalled("")
+	if err != nil {
+		d("No version:", err)
+		version = ""
+	}
+	lines, err := utils.ShellHookEnv(pbName, version, shell)
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		fmt.Println(l)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+
+	envCmd.Flags().StringVar(&envShell, "shell", "",
+		"shell: "+strings.Join(utils.Shells, ", ")+" (default is detected by $SHELL)")
+	envCmd.Flags().BoolVar(&envHook, "hook", false,
+		"print env for the version of the current directory (used by \"init\" hook)")
+	envCmd.Flags().MarkHidden("hook")
+}
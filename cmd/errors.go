@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/ekalinin/pbvm/utils"
+)
+
+// Exit codes of the app (a command started by "run" keeps its own exit code)
+const (
+	exitOK           = 0
+	exitGeneral      = 1
+	exitNotInstalled = 3
+	exitNotFound     = 4
+	exitNoAsset      = 5
+	exitChecksum     = 6
+	exitNetwork      = 7
+	exitPermission   = 8
+	exitRateLimit    = 9
+	exitLocked       = 10
+	exitInternal     = 70
+)
+
+// exitCodesHelp documents exit codes
+const exitCodesHelp = `Exit codes:
+  0   success
+  1   general error
+  3   version is not installed
+  4   version is not found in releases
+  5   release has no asset for the current OS/arch
+  6   checksum mismatch (or checksum is not known)
+  7   network error
+  8   permission denied
+  9   GitHub API rate limit exceeded
+  10  lock is held by another ` + pbName + ` process
+  70  internal error`
+
+// exitCodes maps kinds of errors to exit codes
+var exitCodes = map[error]int{
+	utils.ErrNotInstalled:     exitNotInstalled,
+	utils.ErrNotFound:         exitNotFound,
+	utils.ErrNoAsset:          exitNoAsset,
+	utils.ErrChecksumMismatch: exitChecksum,
+	utils.ErrNetwork:          exitNetwork,
+	utils.ErrPermission:       exitPermission,
+	utils.ErrRateLimit:        exitRateLimit,
+	utils.ErrLocked:           exitLocked,
+}
+
+// exitCode is an error which just sets exit code of the process (for example,
+// exit code of a child process)
+type exitCode int
+
+func (e exitCode) Error() string {
+	return "exit status " + strconv.Itoa(int(e))
+}
+
+// handleError prints an error and returns exit code for it
+func handleError(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	var code exitCode
+	if errors.As(err, &code) {
+		return int(code)
+	}
+
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	if Verbose {
+		for e := errors.Unwrap(err); e != nil; e = errors.Unwrap(e) {
+			fmt.Fprintf(os.Stderr, "  caused by (%T): %v\n", e, e)
+		}
+	}
+
+	if c, ok := exitCodes[utils.KindOf(err)]; ok {
+		return c
+	}
+	return exitGeneral
+}
+
+// handlePanic converts a panic into an internal error, the stack trace is
+// printed only in verbose mode
+func handlePanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "Internal error:", r)
+	if Verbose {
+		os.Stderr.Write(debug.Stack())
+	} else {
+		fmt.Fprintln(os.Stderr, "Run with --verbose to see the details.")
+	}
+	os.Exit(exitInternal)
+}
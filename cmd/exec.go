@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"github.com/ekalinin/pbvm/utils"
+	"github.com/spf13/cobra"
+)
+
+var execVersion string
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	Use:   "exec [--version <version>] [--] <command> [args...]",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Replace " + pbName + " with a command under a version",
+	Long: `Replace ` + pbName + ` with a command under a version.
+
+Unlike "run", ` + pbName + ` does not stay resident as a parent: the command replaces
+its process (exec), so it gets signals and the terminal directly and its
+exit code is returned as is. It is meant for build scripts and rules:
+
+  $ ` + pbName + ` exec --version v3.12.3 -- protoc -I. --go_out=. foo.proto
+
+The version is resolved and the environment is set up the same way as
+for "run" (see "` + pbName + ` run --help"). On Windows there is no exec, so
+the command is run as a child process.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bin, env, err := versionCommand(execVersion, args[0])
+		if err != nil {
+			return err
+		}
+		d("Executing:", bin, args[1:])
+		code, err := utils.ExecCommand(bin, args[1:], env)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return exitCode(code)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+
+	// flags after the command belong to the command
+	execCmd.Flags().SetInterspersed(false)
+
+	execCmd.Flags().StringVar(&execVersion, "version", "",
+		"Version used for command execution (default is resolved from env, pin file or active version)")
+}
@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ekalinin/pbvm/utils"
+	"github.com/spf13/cobra"
+)
+
+var autoSwitch bool
+var initCompletion bool
+
+// Integration snippets: {self} is the quoted path to the app binary, {bin}
+// is the quoted active bin dir, {shell} is the shell name
+const (
+	initSh = `# {app} shell integration
+case ":$PATH:" in
+  *:{bin}:*) ;;
+  *) export PATH={bin}:"$PATH" ;;
+esac
+
+{app}() {
+  if [ "$1" = shell ] && [ $# -gt 1 ]; then
+    eval "$({self} "$@" --shell {shell})" || return
+    _{app}_hook
+    return
+  fi
+  {self} "$@"
+  local code=$?
+  _{app}_hook
+  return $code
+}
+`
+	initShNoHook = `
+_{app}_hook() {
+  :
+}
+`
+	initShHook = `
+_{app}_hook() {
+  eval "$({self} env --hook --shell {shell} 2>/dev/null)"
+}
+`
+	initBashHook = `
+_{app}_prompt() {
+  if [ "$PWD" != "$_{APP}_LAST_PWD" ]; then
+    _{APP}_LAST_PWD=$PWD
+    _{app}_hook
+  fi
+}
+case ";$PROMPT_COMMAND;" in
+  *";_{app}_prompt;"*) ;;
+  *) PROMPT_COMMAND="_{app}_prompt${PROMPT_COMMAND:+;$PROMPT_COMMAND}" ;;
+esac
+`
+	initZshHook = `
+autoload -Uz add-zsh-hook
+add-zsh-hook chpwd _{app}_hook
+_{app}_hook
+`
+	initZshCompletion = `
+if (( $+functions[compdef] )); then
+  compdef _{app} {app}
+fi
+`
+	initFish = `# {app} shell integration
+if not contains -- {bin} $PATH
+  set -gx PATH {bin} $PATH
+end
+
+function {app}
+  if test "$argv[1]" = shell; and test (count $argv) -gt 1
+    {self} $argv --shell fish | source
+    __{app}_hook
+    return
+  end
+  {self} $argv
+  set -l code $status
+  __{app}_hook
+  return $code
+end
+`
+	initFishNoHook = `
+function __{app}_hook
+end
+`
+	initFishHook = `
+function __{app}_hook --on-variable PWD
+  {self} env --hook --shell fish 2>/dev/null | source
+end
+__{app}_hook
+`
+	initPowerShell = `# {app} shell integration
+if (-not ($env:PATH -split [IO.Path]::PathSeparator -contains {bin})) {
+  $env:PATH = {bin} + [IO.Path]::PathSeparator + $env:PATH
+}
+
+function global:{app} {
+  if ($args.Count -gt 1 -and $args[0] -eq 'shell') {
+    $script = & {self} @args --shell powershell | Out-String
+    if ($script) { Invoke-Expression $script }
+    _{app}_hook
+    return
+  }
+  & {self} @args
+  $code = $LASTEXITCODE
+  _{app}_hook
+  $global:LASTEXITCODE = $code
+}
+`
+	initPowerShellNoHook = `
+function global:_{app}_hook {
+}
+`
+	initPowerShellHook = `
+function global:_{app}_hook {
+  $script = & {self} env --hook --shell powershell 2>$null | Out-String
+  if ($script) { Invoke-Expression $script }
+}
+$global:_{app}LastPwd = ''
+if (-not $global:_{app}Prompt) {
+  $global:_{app}Prompt = $function:prompt
+  function global:prompt {
+    if ($PWD.Path -ne $global:_{app}LastPwd) {
+      $global:_{app}LastPwd = $PWD.Path
+      _{app}_hook
+    }
+    & $global:_{app}Prompt
+  }
+}
+`
+)
+
+// initCmd represents the init command
+var initCmd = &cobra.Command{
+	Use:   "init [bash|zsh|fish|powershell]",
+	Short: "Print shell integration script",
+	Long: `Print shell integration script: active bin dir is added to PATH,
+completion is loaded and "` + pbName + ` shell" changes the current shell.
+
+With --auto-switch protoc is switched when the current directory is changed:
+a version pinned for the directory (see "` + pbName + ` run --help") or the global
+one is put into PATH, ` + utils.EnvProtoc + ` and ` + utils.EnvProtocInclude + ` (similar to direnv).
+
+Shell is detected by $SHELL if it is not set. Add to the shell's startup
+file:
+
+Bash (~/.bashrc), Zsh (~/.zshrc):
+  eval "$(` + pbName + ` init --auto-switch)"
+
+Fish (~/.config/fish/config.fish):
+  ` + pbName + ` init fish --auto-switch | source
+
+PowerShell ($PROFILE):
+  ` + pbName + ` init powershell --auto-switch | Out-String | Invoke-Expression`,
+	ValidArgs: utils.Shells,
+	Args:      cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+		shell, err := utils.ParseShell(name)
+		if err != nil {
+			return err
+		}
+
+		self, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		activeDir, err := utils.GetHomeActiveDir(pbName)
+		if err != nil {
+			return err
+		}
+		bin := activeDir + string(os.PathSeparator) + "bin"
+
+		var script []string
+		switch shell {
+		case utils.ShellFish:
+			script = []string{initFish, initFishNoHook}
+			if autoSwitch {
+				script[1] = initFishHook
+			}
+		case utils.ShellPowerShell:
+			script = []string{initPowerShell, initPowerShellNoHook}
+			if autoSwitch {
+				script[1] = initPowerShellHook
+			}
+		default:
+			script = []string{initSh, initShNoHook}
+			if autoSwitch {
+				script[1] = initShHook
+				if shell == utils.ShellZsh {
+					script = append(script, initZshHook)
+				} else {
+					script = append(script, initBashHook)
+				}
+			}
+		}
+
+		r := strings.NewReplacer(
+			"{app}", pbName,
+			"{APP}", strings.ToUpper(pbName),
+			"{shell}", shell,
+			"{self}", utils.QuoteShell(shell, self),
+			"{bin}", utils.QuoteShell(shell, bin),
+		)
+		for _, s := range script {
+			fmt.Print(r.Replace(s))
+		}
+
+		if !initCompletion {
+			return nil
+		}
+		fmt.Println()
+		switch shell {
+		case utils.ShellBash:
+			return cmd.Root().GenBashCompletion(os.Stdout)
+		case utils.ShellZsh:
+			if err := cmd.Root().GenZshCompletion(os.Stdout); err != nil {
+				return err
+			}
+			fmt.Print(r.Replace(initZshCompletion))
+			return nil
+		case utils.ShellFish:
+			return cmd.Root().GenFishCompletion(os.Stdout, true)
+		}
+		return cmd.Root().GenPowerShellCompletion(os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+
+	initCmd.Flags().BoolVar(&autoSwitch, "auto-switch", false,
+		"Switch protoc when the current directory is changed")
+	initCmd.Flags().BoolVar(&initCompletion, "completion", true,
+		"Load completion")
+}
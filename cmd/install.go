@@ -2,73 +2,77 @@ package cmd
 
 import (
 	"context"
+	"errors"
 
 	"github.com/ekalinin/pbvm/utils"
-	"github.com/google/go-github/v32/github"
 	"github.com/spf13/cobra"
 )
 
 var forceInstall bool
+var installChecksum string
+var requireChecksum bool
 
 // installCmd represents the install command
 var installCmd = &cobra.Command{
-	Use:   "install <version>",
+	Use:   "install [<version>]",
 	Short: "Install a version",
 	Long: `Install a version.
 
 If entered version was installled before, then that version will be
 just enabled. In another case, entered version will be downloaded,
-installed and enabled.
+installed and enabled. A partially installed version (an interrupted
+install) is repaired.
+
+Downloaded archive is verified against SHA-256 checksum found (the first
+wins) in --sha256 flag, checksums database (~/.` + pbName + `/checksums.txt,
+sha256sum format) or sums provided within the release.
+
+Version could be an exact tag (v3.12.3) or a constraint resolved against
+remote releases: latest, stable, 3.x, ~3.12, ">=3.19 <4", etc. Releases
+after v3.20 are v21+ (3.21.x is v21.x), so "<4" excludes them. Without
+a version "default-version" config key is used.
 
 To get all available versions use "list-remote" command.`,
-	Args: cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		tag := args[0]
-		d("Installing version:", tag, " ...")
-		installed, _, err := utils.IsInstalledVersion(pbName, tag)
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+		version, err := defaultVersion(args)
 		if err != nil {
-			panic(err)
+			return err
 		}
-
-		d("Is installed:", installed, ", is forced:", forceInstall)
-		if installed && !forceInstall {
-			d("Already installed. Just activate it.")
-			if err := utils.ActivateVersion(pbName, tag); err != nil {
-				panic(err)
-			}
-			return
+		src, err := newReleaseSource()
+		if err != nil {
+			return err
 		}
 
-		ctx := context.Background()
-		client := github.NewClient(nil)
-
-		d("Searching release: ", tag, " ...")
-		release, _, err := client.Repositories.GetReleaseByTag(ctx, pbOwner, pbRepo, tag)
+		d("Resolving version:", version, " ...")
+		tag, err := utils.ResolveRemoteVersion(ctx, src, version)
 		if err != nil {
-			panic(err)
+			return err
 		}
-		d(" ... found:", *release.HTMLURL)
 
-		d("Searching asset in release: ...")
-		asset := utils.FilterAsset(release)
-		if asset == nil {
-			panic("Could not found asset.")
+		unlock, err := acquireLock(utils.GetVersionLockName(tag))
+		if err != nil {
+			return err
 		}
-		d(" ... found:", *asset.BrowserDownloadURL)
+		defer unlock()
 
-		d("Downloading version: ", tag, " ...")
-		downloaded, err := utils.DownloadVersion(pbName, tag, asset, d)
-		if err != nil {
-			panic(err)
+		if _, err := installVersion(ctx, src, tag, forceInstall); err != nil {
+			return err
 		}
-		d(" ... is realy downloaded:", downloaded)
 
 		d("Activating version: ", tag, " ...")
-		if err := utils.ActivateVersion(pbName, tag); err != nil {
-			panic(err)
+		if err := activate(tag); err != nil {
+			return err
+		}
+
+		d("Rebuilding shims ...")
+		if err := rehash(); err != nil {
+			d(" ... failed:", err)
 		}
 
 		d("Done.")
+		return nil
 	},
 }
 
@@ -77,4 +81,125 @@ func init() {
 
 	installCmd.Flags().BoolVarP(&forceInstall, "force", "f", false,
 		"Force installation (reinstall)")
+	installCmd.Flags().StringVar(&installChecksum, "sha256", "",
+		"Expected SHA-256 checksum of the release archive")
+	installCmd.Flags().BoolVar(&requireChecksum, "require-checksum", false,
+		"Fail if checksum of the release archive is not known")
+}
+
+// installVersion installs a version if it is not installed yet (the caller
+// holds the version's lock). Extra checksum sources are checked right after
+// --sha256 flag. Returns true if the version is really installed.
+func installVersion(ctx context.Context, src utils.ReleaseSource, tag string, force bool, checksums ...utils.ChecksumSource) (bool, error) {
+	d("Installing version:", tag, " ...")
+	target, err := installTarget()
+	if err != nil {
+		return false, err
+	}
+	installed, versionDir, err := utils.IsInstalledVersion(pbName, tag)
+	if err != nil {
+		return false, err
+	}
+	if installed {
+		if err := utils.AdoptInstall(versionDir, tag); errors.Is(err, utils.ErrNotInstalled) {
+			d("Installed without manifest and broken, repairing:", err)
+			force = true
+		} else if err != nil {
+			d("Manifest is not written:", err)
+		}
+		if m, err := utils.ReadManifest(versionDir); err == nil && m.Platform != "" && m.Platform != target.String() {
+			d("Installed for another platform:", m.Platform)
+			force = true
+		}
+	}
+
+	d("Is installed:", installed, ", is forced:", force)
+	if installed && !force {
+		d("Already installed.")
+		return false, nil
+	}
+
+	d("Searching release: ", tag, " ...")
+	release, err := src.GetReleaseByTag(ctx, tag)
+	if err != nil {
+		return false, err
+	}
+	d(" ... found:", release.URL)
+
+	d("Searching asset in release: ...")
+	asset := utils.FilterAsset(release.Assets, target)
+	if asset == nil {
+		return false, utils.NewError(utils.ErrNoAsset,
+			"Release %s has no asset for %s", tag, target)
+	}
+	d(" ... found:", asset.URL)
+
+	d("Searching checksum: ...")
+	checksum, checksumOrigin, err := lookupChecksum(ctx, src, release, *asset, installChecksum, checksums...)
+	if err != nil {
+		return false, err
+	}
+	if checksum == "" && requireChecksum {
+		return false, utils.NewError(utils.ErrChecksumMismatch,
+			"Checksum is not known for %s", asset.Name)
+	}
+	if checksum != "" {
+		d(" ... found:", checksum, "in", checksumOrigin)
+	}
+
+	d("Downloading version: ", tag, " ...")
+	downloaded, err := utils.DownloadVersion(ctx, pbName, tag, src, *asset, utils.InstallOptions{
+		Checksum:   checksum,
+		Downloader: utils.NewDownloader(),
+		Force:      force,
+		Target:     target,
+	}, d)
+	if err != nil {
+		return false, err
+	}
+	d(" ... is realy downloaded:", downloaded)
+	return downloaded, nil
+}
+
+// lookupChecksum returns expected checksum of an asset and its origin
+// (static is a checksum set by a flag, extra sources are checked after it)
+func lookupChecksum(ctx context.Context, src utils.ReleaseSource, release *utils.Release, asset utils.Asset, static string, extra ...utils.ChecksumSource) (string, string, error) {
+	db, err := utils.GetHomeChecksumsFile(pbName)
+	if err != nil {
+		return "", "", err
+	}
+	sources := []utils.ChecksumSource{utils.StaticChecksum(static)}
+	sources = append(sources, extra...)
+	sources = append(sources,
+		utils.ChecksumFile(db),
+		utils.ReleaseChecksums{Source: src, Assets: release.Assets},
+	)
+	return utils.LookupChecksum(ctx, asset, sources...)
+}
+
+// adoptInstall validates an installed version without the install manifest
+// (installed by an old version of the app) and writes the manifest once.
+// Returns false if the version is broken.
+func adoptInstall(version, versionDir string) bool {
+	if utils.HasManifest(versionDir) {
+		return true
+	}
+	unlock, err := acquireLock(utils.GetVersionLockName(version))
+	if err != nil {
+		d("Could not adopt", version, ":", err)
+		return true
+	}
+	defer unlock()
+
+	d("Validating install without manifest:", version, " ...")
+	err = utils.AdoptInstall(versionDir, version)
+	if errors.Is(err, utils.ErrNotInstalled) {
+		d(" ... broken:", err)
+		return false
+	}
+	if err != nil {
+		// valid, but the manifest could not be written (read-only home)
+		d(" ... manifest is not written:", err)
+	}
+	return true
 }
@@ -5,7 +5,6 @@ import (
 	"strconv"
 
 	"github.com/ekalinin/pbvm/utils"
-	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 )
 
@@ -14,30 +13,46 @@ var listLocalCmd = &cobra.Command{
 	Aliases: []string{"ls"},
 	Use:     "list-local",
 	Short:   "List local (previously installed) versions",
-	Long:    `Shows list of installed versions.`,
-	Run: func(cmd *cobra.Command, args []string) {
+	Long: `Shows list of installed versions.
+
+Versions marked as "partial" are interrupted installs, they could be
+repaired with "install" or removed with "delete".`,
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// version, install date (folder stat), active?
 		versions, err := utils.ListInstalledVersions(pbName)
 		if err != nil {
-			panic(err)
-		}
-
-		if len(versions) == 0 {
-			return
+			return err
 		}
 
-		table := tablewriter.NewWriter(os.Stdout)
-		table.SetHeader([]string{"Version", "Install date", "Active"})
-
+		res := make([]versionInfo, 0, len(versions))
 		for _, v := range versions {
-			table.Append([]string{
-				v.Version,
-				v.Date.Format(pbDateFormat),
-				strconv.FormatBool(v.Active),
+			if !v.Partial && !adoptInstall(v.Version, v.Path) {
+				v.Partial = true
+			}
+			date := v.Date
+			parsed, err := utils.ParseVersion(v.Version)
+			res = append(res, versionInfo{
+				Version:     v.Version,
+				Prerelease:  err == nil && parsed.IsPrerelease(),
+				InstallDate: &date,
+				Installed:   !v.Partial,
+				Available:   true,
+				Active:      v.Active,
+				InstallPath: v.Path,
+				Partial:     v.Partial,
 			})
 		}
-		table.SetBorder(false)
-		table.Render()
+
+		return render(os.Stdout, res, []column{
+			{"Version", func(v versionInfo) string {
+				if v.Partial {
+					return v.Version + " (partial)"
+				}
+				return v.Version
+			}},
+			{"Install date", func(v versionInfo) string { return formatDate(v.InstallDate) }},
+			{"Active", func(v versionInfo) string { return strconv.FormatBool(v.Active) }},
+		})
 	},
 }
 
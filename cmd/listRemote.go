@@ -2,63 +2,218 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ekalinin/pbvm/utils"
-	"github.com/google/go-github/v32/github"
-	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 )
 
 var numberOfVersions int
+var onlyStable bool
+var onlyPrerelease bool
+var sinceFilter string
+var majorFilter int
+var onlyInstalled bool
+var onlyNotInstalled bool
+var showNotes bool
 
 // listRemoteCmd represents the listRemote command
 var listRemoteCmd = &cobra.Command{
 	Aliases: []string{"lsr"},
 	Use:     "list-remote",
 	Short:   "List available versions",
-	Long:    `List available versions`,
-	Run: func(cmd *cobra.Command, args []string) {
+	Long: `List available versions.
+
+Releases are fetched page by page until the requested number of versions
+matching all filters is found ("-n 0" shows all of them). Column "Available"
+is false for releases without an asset for the current OS/arch (or the one
+set by --os/--arch).`,
+	RunE: func(cmd *cobra.Command, args []string) error {
 		ctx := context.Background()
 
-		client := github.NewClient(nil)
-		opts := &github.ListOptions{Page: 1, PerPage: numberOfVersions}
-		releases, _, err := client.Repositories.ListReleases(ctx, pbOwner, pbRepo, opts)
+		filter, err := newReleaseFilter()
 		if err != nil {
-			panic(err)
+			return err
 		}
 
-		table := tablewriter.NewWriter(os.Stdout)
-		table.SetHeader([]string{"Version", "Pre-release", "Date", "Installed"})
+		src, err := newReleaseSource()
+		if err != nil {
+			return err
+		}
+		target, err := installTarget()
+		if err != nil {
+			return err
+		}
 
-		for _, r := range releases {
-			installed, _, err := utils.IsInstalledVersion(pbName, *r.TagName)
+		res := []versionInfo{}
+		var infoErr error
+		err = utils.WalkReleases(ctx, src, func(r utils.Release) bool {
+			v, err := newRemoteVersionInfo(r, target)
 			if err != nil {
-				panic(err)
+				infoErr = err
+				return false
 			}
-			table.Append([]string{
-				*r.TagName,
-				strconv.FormatBool(*r.Prerelease),
-				(*r.PublishedAt).Format(pbDateFormat),
-				strconv.FormatBool(installed),
-			})
+			if filter(r, v) {
+				res = append(res, v)
+			}
+			return numberOfVersions <= 0 || len(res) < numberOfVersions
+		})
+		if err != nil {
+			return err
 		}
-		table.SetBorder(false)
-		table.Render()
+		if infoErr != nil {
+			return infoErr
+		}
+		sortVersionInfos(res)
+
+		columns := []column{
+			{"Version", func(v versionInfo) string { return v.Version }},
+			{"Pre-release", func(v versionInfo) string { return strconv.FormatBool(v.Prerelease) }},
+			{"Date", func(v versionInfo) string { return formatDate(v.PublishedAt) }},
+			{"Installed", func(v versionInfo) string { return strconv.FormatBool(v.Installed) }},
+			{"Available", func(v versionInfo) string { return strconv.FormatBool(v.Available) }},
+		}
+		if showNotes {
+			columns = append(columns, column{"Notes", func(v versionInfo) string {
+				return firstLine(v.Notes, 60)
+			}})
+		}
+		return render(os.Stdout, res, columns)
 	},
 }
 
+// newRemoteVersionInfo converts a release into the output model (an asset
+// is looked for the target)
+func newRemoteVersionInfo(r utils.Release, target utils.Target) (versionInfo, error) {
+	installed, versionDir, err := utils.IsInstalledVersion(pbName, r.Tag)
+	if err != nil {
+		return versionInfo{}, err
+	}
+	active, err := utils.IsActiveVersion(pbName, r.Tag)
+	if err != nil {
+		return versionInfo{}, err
+	}
+	published := r.PublishedAt
+	v := versionInfo{
+		Version:     r.Tag,
+		Prerelease:  r.Prerelease,
+		PublishedAt: &published,
+		Installed:   installed,
+		Active:      active,
+	}
+	if installed {
+		v.InstallPath = versionDir
+	}
+	if asset := utils.FilterAsset(r.Assets, target); asset != nil {
+		v.Available = true
+		v.AssetName = asset.Name
+		v.AssetSize = asset.Size
+	}
+	if showNotes {
+		v.Notes = r.Notes
+	}
+	return v, nil
+}
+
+// newReleaseFilter returns a filter built from the command line flags
+func newReleaseFilter() (func(r utils.Release, v versionInfo) bool, error) {
+	if onlyStable && onlyPrerelease {
+		return nil, errors.New("Flags --stable and --prerelease are mutually exclusive")
+	}
+	if onlyInstalled && onlyNotInstalled {
+		return nil, errors.New("Flags --installed and --not-installed are mutually exclusive")
+	}
+
+	var sinceDate time.Time
+	var sinceVersion *utils.Version
+	if sinceFilter != "" {
+		var err error
+		if sinceDate, err = parseDate(sinceFilter); err != nil {
+			v, err := utils.ParseVersion(sinceFilter)
+			if err != nil {
+				return nil, errors.New("Flag --since should be a date (" +
+					pbDateFormat + ") or a version: " + sinceFilter)
+			}
+			sinceVersion = &v
+		}
+	}
+
+	return func(r utils.Release, v versionInfo) bool {
+		switch {
+		case onlyStable && r.Prerelease,
+			onlyPrerelease && !r.Prerelease,
+			onlyInstalled && !v.Installed,
+			onlyNotInstalled && v.Installed,
+			!sinceDate.IsZero() && r.PublishedAt.Before(sinceDate):
+			return false
+		}
+		if sinceVersion == nil && majorFilter < 0 {
+			return true
+		}
+		parsed, err := utils.ParseVersion(r.Tag)
+		if err != nil {
+			return false
+		}
+		if sinceVersion != nil && parsed.Less(*sinceVersion) {
+			return false
+		}
+		return majorFilter < 0 || parsed.Major == majorFilter
+	}, nil
+}
+
+// parseDate parses a date in the output format or in ISO format
+func parseDate(s string) (time.Time, error) {
+	t, err := time.Parse(pbDateFormat, s)
+	if err != nil {
+		return time.Parse("2006-01-02", s)
+	}
+	return t, nil
+}
+
+// sortVersionInfos sorts versions, the newest first
+func sortVersionInfos(versions []versionInfo) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return utils.CompareTags(versions[i].Version, versions[j].Version) > 0
+	})
+}
+
+// firstLine returns the first non-empty line of a text cut to max runes
+func firstLine(text string, max int) string {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if r := []rune(line); len(r) > max {
+			return string(r[:max-3]) + "..."
+		}
+		return line
+	}
+	return ""
+}
+
 func init() {
 	rootCmd.AddCommand(listRemoteCmd)
 
-	// TODO: add options:
-	// 	- hide pre-releases
-	// 	- only pre-releases
-	//	- show only latest
-	//  - show descrition
-	//  - show header
-	// 	- show column "installed" (if version already installed)
 	listRemoteCmd.Flags().IntVarP(&numberOfVersions, "number", "n", 10,
-		"Number of last vertions to show")
+		"Number of last vertions to show (0 - all)")
+	listRemoteCmd.Flags().BoolVar(&onlyStable, "stable", false,
+		"Show only releases (hide pre-releases)")
+	listRemoteCmd.Flags().BoolVar(&onlyPrerelease, "prerelease", false,
+		"Show only pre-releases")
+	listRemoteCmd.Flags().StringVar(&sinceFilter, "since", "",
+		"Show versions published since a date ("+pbDateFormat+") or a version (this version or newer)")
+	listRemoteCmd.Flags().IntVar(&majorFilter, "major", -1,
+		"Show only versions of a major version (3, 21, ...)")
+	listRemoteCmd.Flags().BoolVar(&onlyInstalled, "installed", false,
+		"Show only installed versions")
+	listRemoteCmd.Flags().BoolVar(&onlyNotInstalled, "not-installed", false,
+		"Show only not installed versions")
+	listRemoteCmd.Flags().BoolVar(&showNotes, "show-notes", false,
+		"Show release notes")
 }
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ekalinin/pbvm/utils"
+	"github.com/spf13/cobra"
+)
+
+var migrateFrom string
+
+// migrateHomeCmd represents the migrate-home command
+var migrateHomeCmd = &cobra.Command{
+	Use:   "migrate-home",
+	Short: "Move home dir into the configured location",
+	Long: `Move an existing home dir (~/.` + pbName + ` by default) into the configured
+one: ` + utils.GetHomeEnv(pbName) + ` environment variable, "home" config key or XDG base
+dirs (` + strings.ToUpper(pbName) + `_XDG=true or "xdg" config key).
+
+Installed versions, plugins and the active version are kept, shims are
+rebuilt. Target dir should not exist or should be empty. Do not run other
+` + pbName + ` commands meanwhile.`,
+	Example: `  ` + utils.GetHomeEnv(pbName) + `=/opt/` + pbName + ` ` + pbName + ` migrate-home`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from := migrateFrom
+		if from == "" {
+			dir, err := utils.GetDefaultHomeDir(pbName)
+			if err != nil {
+				return err
+			}
+			from = dir
+		}
+
+		to, err := utils.MigrateHome(pbName, from, d)
+		if err != nil {
+			return err
+		}
+		if err := rehash(); err != nil {
+			return err
+		}
+
+		shimsDir, err := utils.GetHomeShimsDir(pbName)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Moved", from, "to", to)
+		fmt.Println("Update PATH if it contains the old shims dir: replace",
+			filepath.Join(from, "shims"), "with", shimsDir)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateHomeCmd)
+
+	migrateHomeCmd.Flags().StringVar(&migrateFrom, "from", "",
+		"home dir to move (default is ~/."+pbName+")")
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/yaml.v2"
+)
+
+// Output formats
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputPlain = "plain"
+)
+
+var outputFormats = []string{outputTable, outputJSON, outputYAML, outputPlain}
+
+// outputFormat is a format of list commands output
+var outputFormat string
+
+// versionInfo is a version shown by list commands
+type versionInfo struct {
+	Name        string     `json:"name,omitempty" yaml:"name,omitempty"`
+	Version     string     `json:"version" yaml:"version"`
+	Prerelease  bool       `json:"prerelease" yaml:"prerelease"`
+	PublishedAt *time.Time `json:"published_at,omitempty" yaml:"published_at,omitempty"`
+	InstallDate *time.Time `json:"install_date,omitempty" yaml:"install_date,omitempty"`
+	Installed   bool       `json:"installed" yaml:"installed"`
+	Partial     bool       `json:"partial,omitempty" yaml:"partial,omitempty"`
+	Active      bool       `json:"active" yaml:"active"`
+	InstallPath string     `json:"install_path,omitempty" yaml:"install_path,omitempty"`
+	AssetName   string     `json:"asset_name,omitempty" yaml:"asset_name,omitempty"`
+	AssetSize   int        `json:"asset_size,omitempty" yaml:"asset_size,omitempty"`
+	Available   bool       `json:"available" yaml:"available"`
+	Notes       string     `json:"notes,omitempty" yaml:"notes,omitempty"`
+}
+
+// column is a column of the table output
+type column struct {
+	header string
+	value  func(v versionInfo) string
+}
+
+// checkOutputFormat returns error if the output format is unknown
+func checkOutputFormat(format string) error {
+	for _, f := range outputFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return errors.New("Unknown output format: " + format +
+		" (expected one of: " + strings.Join(outputFormats, ", ") + ")")
+}
+
+// render writes versions in the selected output format
+func render(w io.Writer, versions []versionInfo, columns []column) error {
+	if err := checkOutputFormat(outputFormat); err != nil {
+		return err
+	}
+
+	switch outputFormat {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(versions)
+	case outputYAML:
+		out, err := yaml.Marshal(versions)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(out)
+		return err
+	case outputPlain:
+		for _, v := range versions {
+			line := v.Version
+			if v.Name != "" {
+				line = v.Name + "@" + v.Version
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(versions) == 0 {
+		return nil
+	}
+
+	table := tablewriter.NewWriter(w)
+	headers := make([]string, 0, len(columns))
+	for _, c := range columns {
+		headers = append(headers, c.header)
+	}
+	table.SetHeader(headers)
+	for _, v := range versions {
+		row := make([]string, 0, len(columns))
+		for _, c := range columns {
+			row = append(row, c.value(v))
+		}
+		table.Append(row)
+	}
+	table.SetBorder(false)
+	table.Render()
+	return nil
+}
+
+// formatDate formats an optional date for the table output
+func formatDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(pbDateFormat)
+}
@@ -0,0 +1,385 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ekalinin/pbvm/utils"
+	"github.com/spf13/cobra"
+)
+
+var forcePluginInstall bool
+var buildPlugin bool
+var pluginChecksum string
+var requirePluginChecksum bool
+var deletePluginYes bool
+
+// pluginCmd represents the plugin command
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "Manage protoc plugins",
+	Long: `Manage protoc plugins (protoc-gen-go, protoc-gen-grpc-web, etc.).
+
+Plugins are installed into ~/.` + pbName + `/plugins/<name>/<version> and active
+plugins are linked into ~/.` + pbName + `/active/bin next to protoc. To get all
+known plugins use "plugin known" command.`,
+}
+
+// pluginInstallCmd represents the plugin install command
+var pluginInstallCmd = &cobra.Command{
+	Use:   "install <name>[@<version>]",
+	Short: "Install a plugin version",
+	Long: `Install a plugin version.
+
+If entered version was installled before, then that version will be
+just enabled. In another case, entered version will be downloaded from
+the plugin's releases (or built with "go install" if there is no release
+asset for the current OS/arch), installed and enabled.
+
+Version could be an exact tag (v1.25.0) or a constraint resolved against
+plugin releases: latest, stable (default), 1.x, ~1.25, etc. Plugins built
+from sources need an exact version. A default version could be set by
+"plugins.<name>" config key.`,
+	Example: `  ` + pbName + ` plugin install protoc-gen-go@v1.25.0
+  ` + pbName + ` plugin install protoc-gen-grpc-web@1.x`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+		name, constraint := pluginConstraint(args[0])
+		p, err := utils.FindPlugin(name)
+		if err != nil {
+			return err
+		}
+
+		src, version, err := resolvePluginVersion(ctx, p, constraint)
+		if err != nil {
+			return err
+		}
+
+		unlock, err := acquireLock(utils.GetPluginLockName(name, version))
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		if err := installPluginVersion(ctx, src, p, version, forcePluginInstall); err != nil {
+			return err
+		}
+
+		d("Activating plugin:", name, version, " ...")
+		return activatePlugin(name, version)
+	},
+}
+
+// pluginActivateCmd represents the plugin activate command
+var pluginActivateCmd = &cobra.Command{
+	Use:   "activate <name>[@<version>]",
+	Short: "Activate a plugin version",
+	Long: `Activate a plugin version. Version should be installed.
+
+Version could be an exact tag (v1.25.0) or a constraint resolved against
+installed versions of the plugin: latest, stable (default), 1.x, etc.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, constraint := pluginConstraint(args[0])
+		version, err := utils.ResolveInstalledPlugin(pbName, name, constraint)
+		if err != nil {
+			return err
+		}
+		return activatePlugin(name, version)
+	},
+}
+
+// pluginDeactivateCmd represents the plugin deactivate command
+var pluginDeactivateCmd = &cobra.Command{
+	Use:   "deactivate <name>",
+	Short: "Deactivate a plugin",
+	Long:  `Deactivate a plugin (remove it from active bin dir).`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		unlock, err := acquireLock(utils.ActiveLockName)
+		if err != nil {
+			return err
+		}
+		err = utils.DeactivatePlugin(pbName, args[0])
+		unlock()
+		if err != nil {
+			return err
+		}
+		return rehash()
+	},
+}
+
+// pluginDeleteCmd represents the plugin delete command
+var pluginDeleteCmd = &cobra.Command{
+	Aliases: []string{"rm"},
+	Use:     "delete <name>[@<version>]",
+	Short:   "Delete a plugin version",
+	Long: `Delete a plugin version. Version should be installed.
+
+Version is resolved against installed versions like in "activate" (the
+default one is taken from "plugins" config key), a version resolved from
+a constraint is deleted only with --yes.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, constraint := pluginConstraint(args[0])
+		c, err := utils.ParseConstraint(constraint)
+		if err != nil {
+			return err
+		}
+		version, err := utils.ResolveInstalledPlugin(pbName, name, constraint)
+		if err != nil {
+			return err
+		}
+		if _, exact := c.Exact(); !exact {
+			if !deletePluginYes {
+				return fmt.Errorf("%s matches %s@%s, run with --yes to delete it",
+					args[0], name, version)
+			}
+			fmt.Fprintln(os.Stderr, "Deleting", name+"@"+version)
+		}
+
+		unlock, err := acquireLock(utils.GetPluginLockName(name, version))
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		if err := deleteInactivePlugin(name, version); err != nil {
+			return err
+		}
+		return rehash()
+	},
+}
+
+// pluginListCmd represents the plugin list command
+var pluginListCmd = &cobra.Command{
+	Aliases: []string{"ls"},
+	Use:     "list",
+	Short:   "List installed plugins",
+	Long:    `Shows list of installed plugins.`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plugins, err := utils.ListInstalledPlugins(pbName)
+		if err != nil {
+			return err
+		}
+
+		res := make([]versionInfo, 0, len(plugins))
+		for _, p := range plugins {
+			date := p.Date
+			parsed, err := utils.ParseVersion(p.Version)
+			res = append(res, versionInfo{
+				Name:        p.Name,
+				Version:     p.Version,
+				Prerelease:  err == nil && parsed.IsPrerelease(),
+				InstallDate: &date,
+				Installed:   true,
+				Available:   true,
+				Active:      p.Active,
+				InstallPath: p.Path,
+			})
+		}
+
+		return render(os.Stdout, res, []column{
+			{"Plugin", func(v versionInfo) string { return v.Name }},
+			{"Version", func(v versionInfo) string { return v.Version }},
+			{"Install date", func(v versionInfo) string { return formatDate(v.InstallDate) }},
+			{"Active", func(v versionInfo) string { return strconv.FormatBool(v.Active) }},
+		})
+	},
+}
+
+// pluginKnownCmd represents the plugin known command
+var pluginKnownCmd = &cobra.Command{
+	Use:   "known",
+	Short: "List known plugins",
+	Long:  `Shows list of plugins which could be installed and where they come from.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, p := range utils.Plugins {
+			from := ""
+			if p.HasReleases() {
+				from = "github.com/" + p.Owner + "/" + p.Repo + " releases"
+			}
+			if p.GoPackage != "" {
+				if from != "" {
+					from += ", "
+				}
+				from += "go install " + p.GoPackage
+			}
+			fmt.Printf("%-26s %s\n", p.Name, from)
+		}
+		return nil
+	},
+}
+
+// resolvePluginVersion resolves a version constraint against plugin
+// releases, returns the release source (nil for plugins built from sources)
+// and the version
+func resolvePluginVersion(ctx context.Context, p *utils.Plugin, constraint string) (utils.ReleaseSource, string, error) {
+	d("Resolving version:", p.Name, constraint, " ...")
+	if !p.HasReleases() {
+		c, err := utils.ParseConstraint(constraint)
+		if err != nil {
+			return nil, "", err
+		}
+		tag, ok := c.Exact()
+		if !ok {
+			return nil, "", fmt.Errorf("Plugin %s is built from sources, an exact version is required", p.Name)
+		}
+		return nil, utils.PluginVersion(tag), nil
+	}
+
+	src, err := newSource(utils.PluginSourceSpec(releaseSource, p.Name), p.Owner, p.Repo)
+	if err != nil {
+		return nil, "", err
+	}
+	tag, err := utils.ResolveRemoteVersion(ctx, src, constraint)
+	if err != nil {
+		return nil, "", err
+	}
+	return src, utils.PluginVersion(tag), nil
+}
+
+// installPluginVersion installs a plugin version if it is not installed yet
+// (the caller holds the plugin's lock). Extra checksum sources are checked
+// right after --sha256 flag.
+func installPluginVersion(ctx context.Context, src utils.ReleaseSource, p *utils.Plugin, version string, force bool, checksums ...utils.ChecksumSource) error {
+	d("Installing plugin:", p.Name, version, " ...")
+	target, err := installTarget()
+	if err != nil {
+		return err
+	}
+	installed, pluginDir, err := utils.IsInstalledPlugin(pbName, p.Name, version)
+	if err != nil {
+		return err
+	}
+	if installed {
+		if m, err := utils.ReadManifest(pluginDir); err == nil && m.Platform != "" && m.Platform != target.String() {
+			d("Installed for another platform:", m.Platform)
+			force = true
+		}
+	}
+	d("Is installed:", installed, ", is forced:", force)
+	if installed && !force {
+		d("Already installed.")
+		return nil
+	}
+
+	opts := utils.InstallOptions{
+		Downloader: utils.NewDownloader(),
+		Force:      force,
+		Target:     target,
+	}
+	asset, release, err := findPluginAsset(ctx, src, p, version, target)
+	if err != nil {
+		return err
+	}
+	if asset == nil {
+		d("Building plugin:", p.GoPackage, version, " ...")
+		if requirePluginChecksum {
+			return utils.NewError(utils.ErrChecksumMismatch,
+				"Checksum is not known for %s@%s (built from sources)", p.Name, version)
+		}
+		_, err := utils.BuildPlugin(ctx, pbName, p, version, opts, d)
+		return err
+	}
+
+	d("Searching checksum: ...")
+	checksum, checksumOrigin, err := lookupChecksum(ctx, src, release, *asset, pluginChecksum, checksums...)
+	if err != nil {
+		return err
+	}
+	if checksum == "" && requirePluginChecksum {
+		return utils.NewError(utils.ErrChecksumMismatch,
+			"Checksum is not known for %s", asset.Name)
+	}
+	if checksum != "" {
+		d(" ... found:", checksum, "in", checksumOrigin)
+	}
+	opts.Checksum = checksum
+
+	d("Downloading plugin:", asset.URL, " ...")
+	_, err = utils.InstallPluginAsset(ctx, pbName, p, version, src, *asset, opts, d)
+	return err
+}
+
+// findPluginAsset returns a release asset of a plugin version for
+// the target (nil if the plugin should be built from sources)
+func findPluginAsset(ctx context.Context, src utils.ReleaseSource, p *utils.Plugin, version string, target utils.Target) (*utils.Asset, *utils.Release, error) {
+	if !p.HasReleases() || buildPlugin {
+		return nil, nil, nil
+	}
+
+	d("Searching release:", p.Tag(version), " ...")
+	release, err := src.GetReleaseByTag(ctx, p.Tag(version))
+	if err != nil {
+		return nil, nil, err
+	}
+	d(" ... found:", release.URL)
+
+	asset := p.FindAsset(release, target)
+	if asset == nil && p.GoPackage == "" {
+		return nil, nil, utils.NewError(utils.ErrNoAsset,
+			"Release %s of %s has no asset for %s", release.Tag, p.Name, target)
+	}
+	return asset, release, nil
+}
+
+// activatePlugin activates an installed plugin under the global lock and
+// rebuilds shims
+func activatePlugin(name, version string) error {
+	unlock, err := acquireLock(utils.ActiveLockName)
+	if err != nil {
+		return err
+	}
+	err = utils.ActivatePlugin(pbName, name, version)
+	unlock()
+	if err != nil {
+		return err
+	}
+	return rehash()
+}
+
+// deleteInactivePlugin deletes a plugin version if it is not active
+func deleteInactivePlugin(name, version string) error {
+	unlock, err := acquireLock(utils.ActiveLockName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	active, err := utils.GetActivePlugin(pbName, name)
+	if err != nil {
+		return err
+	}
+	if active == version {
+		return errors.New("Plugin " + name + "@" + version + " is active at the moment")
+	}
+	return utils.DeletePlugin(pbName, name, version)
+}
+
+func init() {
+	rootCmd.AddCommand(pluginCmd)
+	pluginCmd.AddCommand(pluginInstallCmd)
+	pluginCmd.AddCommand(pluginActivateCmd)
+	pluginCmd.AddCommand(pluginDeactivateCmd)
+	pluginCmd.AddCommand(pluginDeleteCmd)
+	pluginCmd.AddCommand(pluginListCmd)
+	pluginCmd.AddCommand(pluginKnownCmd)
+
+	pluginInstallCmd.Flags().BoolVarP(&forcePluginInstall, "force", "f", false,
+		"Force installation (reinstall)")
+	pluginInstallCmd.Flags().BoolVar(&buildPlugin, "build", false,
+		"Build the plugin with \"go install\" even if there is a release asset")
+	pluginInstallCmd.Flags().StringVar(&pluginChecksum, "sha256", "",
+		"Expected SHA-256 checksum of the release asset")
+	pluginInstallCmd.Flags().BoolVar(&requirePluginChecksum, "require-checksum", false,
+		"Fail if checksum of the release asset is not known")
+	pluginDeleteCmd.Flags().BoolVarP(&deletePluginYes, "yes", "y", false,
+		"Delete a version resolved from a constraint")
+}
@@ -1,10 +1,15 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/ekalinin/pbvm/utils"
 	"github.com/spf13/cobra"
 
 	homedir "github.com/mitchellh/go-homedir"
@@ -13,23 +18,55 @@ import (
 
 var cfgFile string
 
+// offline allows to use only cached release metadata
+var offline bool
+
+// refreshCache forces revalidation of cached release metadata
+var refreshCache bool
+
+// cacheTTL is a time while cached release metadata is used without revalidation
+var cacheTTL time.Duration
+
+// rateLimitWait is a max time to wait for GitHub API rate limit reset
+var rateLimitWait time.Duration
+
+// lockTimeout is a max time to wait for a lock held by another process
+var lockTimeout time.Duration
+
+// targetOS, targetArch and rosetta override the platform which assets are
+// installed for (see installTarget)
+var targetOS string
+var targetArch string
+var rosetta bool
+
+// releaseSource is a spec of the release source (see utils.NewReleaseSource)
+var releaseSource string
+
 // Verbose indicates the need of verbose mode in all commands
 var Verbose bool
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-	Use:     pbName,
-	Short:   "Protocol Buffers Version Manager",
-	Long:    `It is a CLI tool for easy install/switch any versions of the Protocol Buffers.`,
+	Use:   pbName,
+	Short: "Protocol Buffers Version Manager",
+	Long: `It is a CLI tool for easy install/switch any versions of the Protocol Buffers.
+
+` + exitCodesHelp,
 	Version: pbVersion + "\n\nCommit: " + pbCommit + "\nDate:   " + pbBuildDt,
+	// errors are printed by Execute
+	SilenceErrors: true,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// args are valid at this point, so usage is not needed for errors
+		cmd.SilenceUsage = true
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	defer handlePanic()
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(handleError(err))
 	}
 }
 
@@ -42,6 +79,26 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/."+pbName+".yaml)")
 	rootCmd.PersistentFlags().BoolVarP(&Verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputTable,
+		"output format: "+strings.Join(outputFormats, ", "))
+	rootCmd.PersistentFlags().StringVar(&releaseSource, "source", "github",
+		"release source: github, GitHub compatible API URL or local directory")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false,
+		"use only cached release metadata (~/."+pbName+"/cache)")
+	rootCmd.PersistentFlags().BoolVar(&refreshCache, "refresh", false,
+		"revalidate cached release metadata regardless of TTL")
+	rootCmd.PersistentFlags().DurationVar(&cacheTTL, "cache-ttl", time.Hour,
+		"time while cached release metadata is used without revalidation")
+	rootCmd.PersistentFlags().DurationVar(&rateLimitWait, "wait-rate-limit", 0,
+		"max time to wait for GitHub API rate limit reset (0 - do not wait)")
+	rootCmd.PersistentFlags().DurationVar(&lockTimeout, "lock-timeout", 5*time.Minute,
+		"max time to wait for a lock held by another "+pbName+" process")
+	rootCmd.PersistentFlags().StringVar(&targetOS, "os", "",
+		"install assets for OS: linux, darwin (osx), windows (default is the current one)")
+	rootCmd.PersistentFlags().StringVar(&targetArch, "arch", "",
+		"install assets for arch: amd64 (x86_64), arm64 (aarch_64), 386, ppc64le, s390x (default is the current one)")
+	rootCmd.PersistentFlags().BoolVar(&rosetta, "rosetta", false,
+		"allow x86_64 assets on macOS arm64 (for releases without arm64 builds)")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -62,12 +119,98 @@ func initConfig() {
 		viper.SetConfigName("." + pbName)
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	// read in environment variables that match (PBVM_HOME for "home", etc)
+	viper.SetEnvPrefix(pbName)
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viper.AutomaticEnv()
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		// stderr, so piped output is not broken
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+		if userConfig, err = readConfigFile(viper.ConfigFileUsed()); err != nil {
+			os.Exit(handleError(err))
+		}
+	} else if _, ok := err.(viper.ConfigFileNotFoundError); !ok && !os.IsNotExist(err) {
+		os.Exit(handleError(fmt.Errorf("Config %s is broken: %v", viper.ConfigFileUsed(), err)))
+	}
+	if err := loadProjectConfig(); err != nil {
+		os.Exit(handleError(err))
+	}
+	if err := applyConfig(); err != nil {
+		os.Exit(handleError(err))
+	}
+}
+
+// newReleaseSource returns a source of the protoc releases
+func newReleaseSource() (utils.ReleaseSource, error) {
+	return newSource(releaseSource, pbOwner, pbRepo)
+}
+
+// newSource returns a source of releases of a GitHub repository
+func newSource(spec, owner, repo string) (utils.ReleaseSource, error) {
+	cacheDir, err := utils.GetHomeCacheDir(pbName)
+	if err != nil {
+		return nil, err
 	}
+
+	token := githubToken()
+	auth := &utils.TokenTransport{
+		Token: token,
+		Hosts: utils.TokenHosts(spec),
+		Base:  utils.NewHTTPTransport(),
+	}
+	api := &http.Client{
+		Transport: &utils.CacheTransport{
+			Dir:     cacheDir,
+			TTL:     cacheTTL,
+			Offline: offline,
+			Refresh: refreshCache,
+			Base:    auth,
+		},
+	}
+	opts := utils.SourceOptions{
+		APIClient:        api,
+		DownloadClient:   &http.Client{Transport: auth},
+		Authenticated:    token != "",
+		MaxRateLimitWait: rateLimitWait,
+	}
+	if offline {
+		opts.DownloadClient = &http.Client{Transport: utils.OfflineTransport{}}
+	}
+	return utils.NewReleaseSource(spec, owner, repo, opts)
+}
+
+// githubToken returns GitHub token from env or config ("github-token" key)
+func githubToken() string {
+	for _, name := range utils.TokenEnvNames(pbName) {
+		if token := os.Getenv(name); token != "" {
+			return token
+		}
+	}
+	return viper.GetString("github-token")
+}
+
+// installTarget returns the platform which assets are installed for
+func installTarget() (utils.Target, error) {
+	return utils.ParseTarget(targetOS, targetArch, rosetta)
+}
+
+// acquireLock acquires a named lock (see utils.AcquireLock), returns
+// a function releasing it
+func acquireLock(name string) (func(), error) {
+	l, err := utils.AcquireLock(context.Background(), pbName, name, lockTimeout, func(pid int) {
+		fmt.Fprintf(os.Stderr, "Waiting for lock held by PID %d ...\n", pid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	d("Lock acquired:", name)
+	return func() {
+		if err := l.Release(); err != nil {
+			d("Failed to release lock", name, ":", err)
+		}
+	}, nil
 }
 
 func d(ms ...interface{}) {
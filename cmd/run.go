@@ -1,64 +1,101 @@
 package cmd
 
 import (
-	"errors"
-	"os/exec"
-	"strings"
+	"os"
 
 	"github.com/ekalinin/pbvm/utils"
 	"github.com/spf13/cobra"
 )
 
-var version string
+var runVersion string
 
 // runCmd represents the run command
 var runCmd = &cobra.Command{
-	Use:           "run <command>",
-	Args:          cobra.ExactArgs(1),
-	Short:         "Run a command under a version",
-	Long:          `Run a command under a version`,
-	SilenceUsage:  true,
-	SilenceErrors: true,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(version) < 5 {
-			return errors.New("Version is incorrect: " + version)
-		}
+	Use:   "run [--version <version>] [--] <command> [args...]",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Run a command under a version",
+	Long: `Run a command under a version.
 
-		installed, _, err := utils.IsInstalledVersion(pbName, version)
-		if err != nil {
-			return err
-		}
-		if !installed {
-			return errors.New("Version is not installed: " + version)
-		}
+Arguments are passed to the command as is (no splitting by spaces),
+stdin/stdout/stderr are streamed and the exit code of the command becomes
+the exit code of ` + pbName + `. Flags of ` + pbName + ` should go before the command:
 
-		originVersion, err := utils.GetActiveVersion(pbName)
-		if err != nil {
-			return err
-		}
+  $ ` + pbName + ` run --version v3.12.3 -- protoc -I. --go_out=. foo.proto
 
-		// TODO: run command without affecting other sessions
-		// (change PATH & syscall.Exec?)
+The command is run with the version's bin dir prepended to PATH and
+` + utils.EnvProtoc + `, ` + utils.EnvProtocInclude + ` env variables set. The globally
+active version is not changed, so it is safe to run in parallel.
 
-		if err := utils.ActivateVersion(pbName, version); err != nil {
+Version could be an exact tag or a constraint (3.x, ~3.12, latest) resolved
+against installed versions. If --version is not set, then the version is
+resolved from (the first found):
+
+  - ` + utils.GetVersionEnvName(pbName) + ` env variable
+  - ` + utils.PinFileName + `, ` + utils.GetProjectLockName(pbName) + `, ` + utils.GetProjectFileName(pbName) + ` ("protoc" key) or
+    ` + utils.GetProjectConfigName(pbName) + ` ("version" key) file in the current directory or
+    any of its parents
+  - globally active version`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bin, env, err := versionCommand(runVersion, args[0])
+		if err != nil {
 			return err
 		}
-		defer utils.ActivateVersion(pbName, originVersion)
-
-		cs := strings.Split(args[0], " ")
-		command := exec.Command(cs[0], cs[1:]...)
-		out, err := command.CombinedOutput()
+		code, err := utils.RunCommand(bin, args[1:], env)
 		if err != nil {
 			return err
 		}
-		println(string(out))
+		if code != 0 {
+			return exitCode(code)
+		}
 		return nil
 	},
 }
 
+// versionCommand resolves a version (explicit one or see utils.ResolveVersion)
+// and returns a path to the command and env for running it under the version
+func versionCommand(explicit, name string) (string, []string, error) {
+	version, err := resolveInstalled(explicit)
+	if err != nil {
+		return "", nil, err
+	}
+
+	env, err := utils.VersionEnv(pbName, version, os.Environ())
+	if err != nil {
+		return "", nil, err
+	}
+
+	bin, err := utils.LookPath(name, env)
+	if err != nil {
+		return "", nil, err
+	}
+	return bin, env, nil
+}
+
+// resolveInstalled resolves a version (explicit one or see
+// utils.ResolveVersion) and checks it is installed
+func resolveInstalled(explicit string) (string, error) {
+	version, origin, err := utils.ResolveVersion(pbName, explicit)
+	if err != nil {
+		return "", err
+	}
+	d("Using version", version, "from", origin)
+
+	installed, _, err := utils.IsInstalledVersion(pbName, version)
+	if err != nil {
+		return "", err
+	}
+	if !installed {
+		return "", utils.NewError(utils.ErrNotInstalled, "Version %s is not installed", version)
+	}
+	return version, nil
+}
+
 func init() {
 	rootCmd.AddCommand(runCmd)
 
-	runCmd.Flags().StringVar(&version, "version", "v",
-		"Version used for command execution")
+	// flags after the command belong to the command
+	runCmd.Flags().SetInterspersed(false)
+
+	runCmd.Flags().StringVar(&runVersion, "version", "",
+		"Version used for command execution (default is resolved from env, pin file or active version)")
 }
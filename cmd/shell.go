@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ekalinin/pbvm/utils"
+	"github.com/spf13/cobra"
+)
+
+var shellShell string
+var unsetShell bool
+
+// shellCmd represents the shell command
+var shellCmd = &cobra.Command{
+	Use:   "shell [<version>]",
+	Short: "Set a version for the current shell",
+	Long: `Set a version for the current shell (` + utils.GetVersionEnvName(pbName) + ` env variable),
+so shims and "run" in this terminal use it instead of the global and pinned
+ones. PATH, ` + utils.EnvProtoc + ` and ` + utils.EnvProtocInclude + ` are set as by "` + pbName + ` env".
+
+A process could not change env of its shell, so the command prints shell
+commands which should be evaluated (the shell function installed by
+"` + pbName + ` init" does it automatically). Without a version the current
+shell version is printed.
+
+Version could be an exact tag or a constraint resolved against installed
+versions. Shell is detected by $SHELL, supported shells:
+` + strings.Join(utils.Shells, ", ") + `.`,
+	Example: `  eval "$(` + pbName + ` shell v3.12.3)"
+  eval "$(` + pbName + ` shell --unset)"`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		shell, err := utils.ParseShell(shellShell)
+		if err != nil {
+			return err
+		}
+		envName := utils.GetVersionEnvName(pbName)
+
+		if unsetShell {
+			if len(args) > 0 {
+				return errors.New("Version could not be set with --unset")
+			}
+			lines, err := utils.ShellHookEnv(pbName, "", shell)
+			if err != nil {
+				return err
+			}
+			for _, l := range append(lines, utils.UnsetEnv(shell, envName)) {
+				fmt.Println(l)
+			}
+			return nil
+		}
+		if len(args) == 0 {
+			version := os.Getenv(envName)
+			if version == "" {
+				return utils.NewError(utils.ErrNotFound, "Shell version is not set (%s is empty)", envName)
+			}
+			fmt.Println(version)
+			return nil
+		}
+
+		version, err := utils.ResolveInstalledVersion(pbName, args[0])
+		if err != nil {
+			return err
+		}
+		installed, _, err := utils.IsInstalledVersion(pbName, version)
+		if err != nil {
+			return err
+		}
+		if !installed {
+			return utils.NewError(utils.ErrNotInstalled,
+				"Version %s is not installed. Please, run: '%s install %[1]s'",
+				version, pbName)
+		}
+		lines, err := utils.ShellVersionEnv(pbName, version, shell)
+		if err != nil {
+			return err
+		}
+		for _, l := range lines {
+			fmt.Println(l)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(shellCmd)
+
+	shellCmd.Flags().StringVar(&shellShell, "shell", "",
+		"shell: "+strings.Join(utils.Shells, ", ")+" (default is detected by $SHELL)")
+	shellCmd.Flags().BoolVar(&unsetShell, "unset", false,
+		"Unset the shell version (use the global one)")
+}
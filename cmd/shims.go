@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ekalinin/pbvm/utils"
+	"github.com/spf13/cobra"
+)
+
+// shimsCmd represents the shims command
+var shimsCmd = &cobra.Command{
+	Use:   "shims",
+	Short: "List shims",
+	Long: `List shims.
+
+Shims are small executables (protoc and all other executables of installed
+versions) which run the version resolved for the current directory (see
+"` + pbName + ` run --help"). To use shims, add shims dir to PATH:
+
+  $ export PATH="$HOME/.` + pbName + `/shims:$PATH"`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		shimsDir, err := utils.GetHomeShimsDir(pbName)
+		if err != nil {
+			return err
+		}
+		names, err := utils.ListShimNames(pbName)
+		if err != nil {
+			return err
+		}
+		d("Shims dir:", shimsDir)
+		for _, n := range names {
+			fmt.Println(n)
+		}
+		return nil
+	},
+}
+
+// rehashCmd represents the rehash command
+var rehashCmd = &cobra.Command{
+	Use:   "rehash",
+	Short: "Rebuild shims",
+	Long:  `Rebuild shims for all executables of installed versions.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return rehash()
+	},
+}
+
+// shimExecCmd is called by shims
+var shimExecCmd = &cobra.Command{
+	Use:                utils.ShimCommand + " <name> [args...]",
+	Hidden:             true,
+	Args:               cobra.MinimumNArgs(1),
+	DisableFlagParsing: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version, bin, err := utils.ResolveShim(pbName, args[0])
+		if err != nil {
+			return err
+		}
+		env := os.Environ()
+		if version != "" {
+			env, err = utils.VersionEnv(pbName, version, env)
+			if err != nil {
+				return err
+			}
+		}
+		// pbvm is replaced with the executable (if the OS allows)
+		code, err := utils.ExecCommand(bin, args[1:], env)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return exitCode(code)
+		}
+		return nil
+	},
+}
+
+// rehash rebuilds shims
+func rehash() error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	unlock, err := acquireLock(utils.ActiveLockName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	shims, err := utils.WriteShims(pbName, self)
+	if err != nil {
+		return err
+	}
+	d("Shims written:", shims)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(shimsCmd)
+	rootCmd.AddCommand(rehashCmd)
+	rootCmd.AddCommand(shimExecCmd)
+}
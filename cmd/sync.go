@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ekalinin/pbvm/utils"
+	"github.com/spf13/cobra"
+)
+
+var frozenSync bool
+var updateSync bool
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Install protoc and plugins of the project",
+	Long: `Install protoc and plugins declared in the project's manifest.
+
+The manifest (` + pbName + `.yaml) is looked for in the current directory and
+its parents:
+
+  protoc: "~3.12"
+  plugins:
+    protoc-gen-go: v1.25.0
+    protoc-gen-grpc-web: 1.x
+
+Resolved versions, asset URLs and SHA-256 sums are written into the lock
+file (` + pbName + `.lock) next to the manifest. Locked versions are reused until
+the manifest is changed (or --update is set), locked sums are used to
+verify downloads. Assets are locked per platform, so the lock file could be
+shared between different OS/arch.
+
+Global active version is not changed: "run", "current" and shims use
+versions from the lock file inside the project.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if frozenSync && updateSync {
+			return errors.New("Flags --frozen and --update could not be used together")
+		}
+		ctx := context.Background()
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		dir, err := utils.FindProject(pbName, cwd)
+		if err != nil {
+			return err
+		}
+		if dir == "" {
+			return utils.NewError(utils.ErrNotFound,
+				"%s is not found in the current directory or its parents", utils.GetProjectFileName(pbName))
+		}
+		project, err := utils.ReadProject(filepath.Join(dir, utils.GetProjectFileName(pbName)))
+		if err != nil {
+			return err
+		}
+		lockFile := filepath.Join(dir, utils.GetProjectLockName(pbName))
+		lock, err := utils.ReadProjectLock(lockFile)
+		if err != nil {
+			return err
+		}
+		d("Project:", dir)
+
+		changed := false
+		if project.Protoc == "" && lock.Protoc != nil {
+			if frozenSync {
+				return lockOutOfDate(lockFile)
+			}
+			lock.Protoc = nil
+			changed = true
+		}
+		if project.Protoc != "" {
+			c, err := syncProtoc(ctx, project.Protoc, lock, lockFile)
+			if err != nil {
+				return err
+			}
+			changed = changed || c
+		}
+
+		names := make([]string, 0, len(project.Plugins))
+		for name := range project.Plugins {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for name := range lock.Plugins {
+			if _, ok := project.Plugins[name]; !ok {
+				if frozenSync {
+					return lockOutOfDate(lockFile)
+				}
+				delete(lock.Plugins, name)
+				changed = true
+			}
+		}
+		for _, name := range names {
+			c, err := syncPlugin(ctx, name, project.Plugins[name], lock, lockFile)
+			if err != nil {
+				return err
+			}
+			changed = changed || c
+		}
+
+		// with --frozen only assets of a new platform could be added, they
+		// are not written
+		if changed && !frozenSync {
+			d("Writing lock file:", lockFile)
+			if err := utils.WriteProjectLock(pbName, lockFile, lock); err != nil {
+				return err
+			}
+		}
+
+		if lock.Protoc != nil {
+			fmt.Println("protoc", lock.Protoc.Version)
+		}
+		for _, name := range names {
+			fmt.Println(name, lock.Plugins[name].Version)
+		}
+		return rehash()
+	},
+}
+
+// syncProtoc installs protoc version of the project, returns true if
+// the lock is changed
+func syncProtoc(ctx context.Context, constraint string, lock *utils.ProjectLock, lockFile string) (bool, error) {
+	src, err := newReleaseSource()
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	locked := lock.Protoc
+	if locked == nil || locked.Constraint != constraint || updateSync {
+		if frozenSync {
+			return false, lockOutOfDate(lockFile)
+		}
+		d("Resolving version:", constraint, " ...")
+		tag, err := utils.ResolveRemoteVersion(ctx, src, constraint)
+		if err != nil {
+			return false, err
+		}
+		if locked == nil || locked.Version != tag {
+			locked = &utils.LockedTool{Version: tag}
+		}
+		locked.Constraint = constraint
+		lock.Protoc = locked
+		changed = true
+	}
+
+	unlock, err := acquireLock(utils.GetVersionLockName(locked.Version))
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	checksums := utils.LockChecksums{File: lockFile, Tool: locked}
+	if _, err := installVersion(ctx, src, locked.Version, false, checksums); err != nil {
+		return false, err
+	}
+	versionDir, err := utils.GetHomeVersionDir(pbName, locked.Version)
+	if err != nil {
+		return false, err
+	}
+	c, err := lockAsset(locked, versionDir)
+	return changed || c, err
+}
+
+// syncPlugin installs a plugin version of the project, returns true if
+// the lock is changed
+func syncPlugin(ctx context.Context, name, constraint string, lock *utils.ProjectLock, lockFile string) (bool, error) {
+	p, err := utils.FindPlugin(name)
+	if err != nil {
+		return false, err
+	}
+	if constraint == "" {
+		constraint = "stable"
+	}
+	if lock.Plugins == nil {
+		lock.Plugins = map[string]*utils.LockedTool{}
+	}
+
+	changed := false
+	locked := lock.Plugins[name]
+	if locked == nil || locked.Constraint != constraint || updateSync {
+		if frozenSync {
+			return false, lockOutOfDate(lockFile)
+		}
+		_, version, err := resolvePluginVersion(ctx, p, constraint)
+		if err != nil {
+			return false, err
+		}
+		if locked == nil || locked.Version != version {
+			locked = &utils.LockedTool{Version: version}
+		}
+		locked.Constraint = constraint
+		lock.Plugins[name] = locked
+		changed = true
+	}
+
+	// locked version is exact, so it is resolved without requests
+	src, version, err := resolvePluginVersion(ctx, p, locked.Version)
+	if err != nil {
+		return false, err
+	}
+
+	unlock, err := acquireLock(utils.GetPluginLockName(name, version))
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	checksums := utils.LockChecksums{File: lockFile, Tool: locked}
+	if err := installPluginVersion(ctx, src, p, version, false, checksums); err != nil {
+		return false, err
+	}
+	pluginDir, err := utils.GetHomePluginDir(pbName, name, version)
+	if err != nil {
+		return false, err
+	}
+	c, err := lockAsset(locked, pluginDir)
+	return changed || c, err
+}
+
+// lockAsset records the installed asset of the install platform (taken from
+// the install manifest in dir), returns true if the lock is changed
+func lockAsset(locked *utils.LockedTool, dir string) (bool, error) {
+	m, err := utils.ReadManifest(dir)
+	if err != nil {
+		return false, err
+	}
+	if m.Asset == "" || m.SHA256 == "" {
+		// built from sources or installed before manifests were introduced
+		return false, nil
+	}
+
+	platform := m.Platform
+	if platform == "" {
+		platform = utils.HostTarget().String()
+	}
+	asset := utils.LockedAsset{Name: m.Asset, URL: m.URL, SHA256: m.SHA256}
+	if prev, ok := locked.Assets[platform]; ok {
+		if prev.Name == asset.Name && prev.SHA256 != asset.SHA256 {
+			return false, &utils.ChecksumError{File: m.Asset, Expected: prev.SHA256, Actual: asset.SHA256}
+		}
+		if prev == asset {
+			return false, nil
+		}
+	}
+	if locked.Assets == nil {
+		locked.Assets = map[string]utils.LockedAsset{}
+	}
+	locked.Assets[platform] = asset
+	return true, nil
+}
+
+// lockOutOfDate returns an error for a lock file which does not match
+// the manifest
+func lockOutOfDate(lockFile string) error {
+	return fmt.Errorf("%s is out of date, run \"%s sync\" without --frozen", lockFile, pbName)
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+
+	syncCmd.Flags().BoolVar(&frozenSync, "frozen", false,
+		"Fail if the lock file does not match the manifest (do not update it)")
+	syncCmd.Flags().BoolVar(&updateSync, "update", false,
+		"Resolve all versions again (update the lock file)")
+}
@@ -8,4 +8,5 @@ require (
 	github.com/olekukonko/tablewriter v0.0.4
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/viper v1.4.0
+	gopkg.in/yaml.v2 v2.2.2
 )
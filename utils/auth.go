@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// TokenEnvNames are env variables with a GitHub token (the first set wins)
+func TokenEnvNames(app string) []string {
+	return []string{strings.ToUpper(app) + "_GITHUB_TOKEN", "GITHUB_TOKEN"}
+}
+
+// TokenHosts returns hosts a token could be sent to for a release source spec
+// (see NewReleaseSource)
+func TokenHosts(spec string) []string {
+	if spec == "" || spec == "github" {
+		return []string{"api.github.com", "github.com", "uploads.github.com"}
+	}
+	if u, err := url.Parse(spec); err == nil && u.Hostname() != "" &&
+		(u.Scheme == "http" || u.Scheme == "https") {
+		return []string{u.Hostname()}
+	}
+	return nil
+}
+
+// TokenTransport is an http.RoundTripper which adds a GitHub token to
+// requests to the known hosts (the token is not leaked on redirects to
+// other hosts, like asset storages)
+type TokenTransport struct {
+	Token string
+	Hosts []string
+	// Base is used for real requests (http.DefaultTransport if nil)
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *TokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t.Token == "" || req.Header.Get("Authorization") != "" || !t.knownHost(req.URL.Hostname()) {
+		return base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "token "+t.Token)
+	return base.RoundTrip(req)
+}
+
+func (t *TokenTransport) knownHost(host string) bool {
+	for _, h := range t.Hosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// RateLimitError is returned when GitHub API rate limit is exceeded
+type RateLimitError struct {
+	// Reset is a time when the limit is reset (zero if unknown)
+	Reset time.Time
+	// Secondary is true for secondary (abuse) rate limits
+	Secondary bool
+	// RetryAfter is a delay requested by GitHub (zero if unknown)
+	RetryAfter time.Duration
+	// Authenticated is true if a token was used
+	Authenticated bool
+}
+
+func (e *RateLimitError) Error() string {
+	msg := "GitHub API rate limit exceeded"
+	if e.Secondary {
+		msg = "GitHub API secondary rate limit exceeded"
+	}
+	if w := e.wait(time.Now()); w > 0 {
+		msg += fmt.Sprintf(", retry after %s", w.Round(time.Second))
+		if !e.Reset.IsZero() {
+			msg += " (at " + e.Reset.Local().Format("15:04:05") + ")"
+		}
+	}
+	if !e.Authenticated {
+		msg += ". Set GITHUB_TOKEN to raise the limit"
+	}
+	return msg
+}
+
+// wait returns how long to wait before the next try (zero if unknown)
+func (e *RateLimitError) wait(now time.Time) time.Duration {
+	if e.RetryAfter > 0 {
+		return e.RetryAfter
+	}
+	if !e.Reset.IsZero() && e.Reset.After(now) {
+		return e.Reset.Sub(now)
+	}
+	return 0
+}
+
+// fromGitHubError converts GitHub rate limit errors into RateLimitError
+func fromGitHubError(err error, authenticated bool) error {
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		return &RateLimitError{Reset: rateErr.Rate.Reset.Time, Authenticated: authenticated}
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		res := &RateLimitError{Secondary: true, Authenticated: authenticated}
+		if abuseErr.RetryAfter != nil {
+			res.RetryAfter = *abuseErr.RetryAfter
+		}
+		return res
+	}
+	return err
+}
+
+// retryRateLimit calls fn and retries it while GitHub API rate limit is
+// exceeded and total waiting time is less than maxWait
+func retryRateLimit(ctx context.Context, maxWait time.Duration, authenticated bool, fn func() error) error {
+	deadline := time.Now().Add(maxWait)
+	backoff := 30 * time.Second
+	for {
+		err := fromGitHubError(fn(), authenticated)
+		var rateErr *RateLimitError
+		if !errors.As(err, &rateErr) || maxWait <= 0 {
+			return err
+		}
+
+		wait := rateErr.wait(time.Now())
+		if wait <= 0 {
+			// limit without a hint, exponential backoff
+			wait = backoff
+			backoff *= 2
+		}
+		// a small gap to be sure the limit is reset
+		wait += time.Second
+		if time.Now().Add(wait).After(deadline) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
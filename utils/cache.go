@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrOffline is returned in offline mode if a response is not cached
+var ErrOffline = errors.New("Network is not used in offline mode and response is not cached")
+
+// cacheHeader is set in responses served from cache
+const cacheHeader = "X-From-Cache"
+
+// CacheTransport is an http.RoundTripper which caches GET responses on disk.
+// A cached response is used while it is younger than TTL, after that it is
+// revalidated with If-None-Match (ETag). A stale response is also used if
+// the network is not available.
+type CacheTransport struct {
+	Dir string
+	TTL time.Duration
+	// Offline serves only cached responses (regardless of TTL)
+	Offline bool
+	// Refresh revalidates cached responses regardless of TTL
+	Refresh bool
+	// Base is used for real requests (http.DefaultTransport if nil)
+	Base http.RoundTripper
+}
+
+// cacheEntry is a cached response
+type cacheEntry struct {
+	URL       string      `json:"url"`
+	ETag      string      `json:"etag"`
+	FetchedAt time.Time   `json:"fetched_at"`
+	Header    http.Header `json:"header"`
+	Body      []byte      `json:"body"`
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *CacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.base().RoundTrip(req)
+	}
+
+	file := t.file(req)
+	entry, err := t.load(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry != nil && (t.Offline || !t.Refresh && time.Since(entry.FetchedAt) < t.TTL) {
+		return entry.response(req), nil
+	}
+	if t.Offline {
+		return nil, ErrOffline
+	}
+
+	if entry != nil && entry.ETag != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	resp, err := t.base().RoundTrip(req)
+	if err != nil {
+		if entry != nil {
+			// network is not available, use stale response
+			return entry.response(req), nil
+		}
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && entry != nil:
+		resp.Body.Close()
+		entry.FetchedAt = time.Now()
+		if err := t.save(file, entry); err != nil {
+			return nil, err
+		}
+		return entry.response(req), nil
+	case resp.StatusCode == http.StatusOK:
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		entry = &cacheEntry{
+			URL:       req.URL.String(),
+			ETag:      resp.Header.Get("ETag"),
+			FetchedAt: time.Now(),
+			Header:    resp.Header,
+			Body:      body,
+		}
+		if err := t.save(file, entry); err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	}
+	return resp, nil
+}
+
+func (t *CacheTransport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+func (t *CacheTransport) file(req *http.Request) string {
+	h := sha256.Sum256([]byte(req.URL.String() + "\n" + req.Header.Get("Accept")))
+	return filepath.Join(t.Dir, hex.EncodeToString(h[:])+".json")
+}
+
+func (t *CacheTransport) load(file string) (*cacheEntry, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		// broken entry is just ignored
+		return nil, nil
+	}
+	return entry, nil
+}
+
+func (t *CacheTransport) save(file string, entry *cacheEntry) error {
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	// a unique tmp file, so concurrent processes do not clash
+	tmp, err := ioutil.TempFile(t.Dir, filepath.Base(file)+".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	header := http.Header{}
+	for k, v := range e.Header {
+		// stale rate limits should not block new requests
+		if strings.HasPrefix(http.CanonicalHeaderKey(k), "X-Ratelimit-") {
+			continue
+		}
+		header[k] = v
+	}
+	header.Set(cacheHeader, "1")
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// OfflineTransport is an http.RoundTripper which fails all requests
+type OfflineTransport struct{}
+
+// RoundTrip implements http.RoundTripper
+func (OfflineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, ErrOffline
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ChecksumError is returned when a file has unexpected SHA-256 checksum
+type ChecksumError struct {
+	File     string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("Checksum mismatch for %s: expected sha256 %s, got %s",
+		e.File, e.Expected, e.Actual)
+}
+
+// ChecksumSource looks up an expected SHA-256 checksum of an asset
+type ChecksumSource interface {
+	// Checksum returns hex encoded checksum or empty string if unknown
+	Checksum(ctx context.Context, asset Asset) (string, error)
+	// String returns a human readable name of the source
+	String() string
+}
+
+// StaticChecksum is a checksum set explicitly (from a command line flag, etc)
+type StaticChecksum string
+
+// Checksum returns checksum itself
+func (c StaticChecksum) Checksum(ctx context.Context, asset Asset) (string, error) {
+	return normalizeChecksum(string(c)), nil
+}
+
+func (c StaticChecksum) String() string {
+	return "explicit value"
+}
+
+// ChecksumFile is a file in sha256sum format ("<hex>  <asset name>" per line)
+type ChecksumFile string
+
+// Checksum returns checksum for an asset from the file
+func (f ChecksumFile) Checksum(ctx context.Context, asset Asset) (string, error) {
+	file, err := os.Open(string(f))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	sums, err := ParseChecksums(file)
+	if err != nil {
+		return "", err
+	}
+	return sums[asset.Name], nil
+}
+
+func (f ChecksumFile) String() string {
+	return string(f)
+}
+
+// ReleaseChecksums looks up checksums provided within a release: either
+// "<asset>.sha256" or a common sums file ("sha256sums.txt", "checksums.txt")
+type ReleaseChecksums struct {
+	Source ReleaseSource
+	Assets []Asset
+}
+
+// Checksum returns checksum for an asset from the release's sums files
+func (r ReleaseChecksums) Checksum(ctx context.Context, asset Asset) (string, error) {
+	for _, a := range r.Assets {
+		name := strings.ToLower(a.Name)
+		single := name == strings.ToLower(asset.Name)+".sha256"
+		common := name == "sha256sums" || name == "sha256sums.txt" || name == "checksums.txt"
+		if !single && !common {
+			continue
+		}
+
+		rc, err := r.Source.OpenAsset(ctx, a, 0)
+		if err != nil {
+			return "", err
+		}
+		sums, err := ParseChecksums(rc)
+		rc.Close()
+		if err != nil {
+			return "", err
+		}
+
+		if sum, ok := sums[asset.Name]; ok {
+			return sum, nil
+		}
+		if sum, ok := sums[""]; ok && single {
+			return sum, nil
+		}
+	}
+	return "", nil
+}
+
+func (r ReleaseChecksums) String() string {
+	return "release sums"
+}
+
+// LookupChecksum returns the first known checksum of an asset and the name
+// of the source it was found in
+func LookupChecksum(ctx context.Context, asset Asset, sources ...ChecksumSource) (string, string, error) {
+	for _, s := range sources {
+		sum, err := s.Checksum(ctx, asset)
+		if err != nil {
+			return "", "", err
+		}
+		if sum != "" {
+			return sum, s.String(), nil
+		}
+	}
+	return "", "", nil
+}
+
+// ParseChecksums parses sha256sum output into map "file name -> checksum".
+// A line with just a checksum is stored with an empty file name.
+func ParseChecksums(r io.Reader) (map[string]string, error) {
+	res := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		name := ""
+		if len(fields) > 1 {
+			// "*" marks binary mode in sha256sum output
+			name = path.Base(strings.TrimPrefix(fields[1], "*"))
+		}
+		res[name] = normalizeChecksum(fields[0])
+	}
+	return res, scanner.Err()
+}
+
+// FileSHA256 returns hex encoded SHA-256 checksum of a file
+func FileSHA256(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifySHA256 returns ChecksumError if a file's checksum is not expected one
+func VerifySHA256(file, expected string) error {
+	actual, err := FileSHA256(file)
+	if err != nil {
+		return err
+	}
+	if actual != normalizeChecksum(expected) {
+		return &ChecksumError{File: file, Expected: expected, Actual: actual}
+	}
+	return nil
+}
+
+func normalizeChecksum(sum string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(sum), "sha256:"))
+}
@@ -0,0 +1,302 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Aliases accepted as a version constraint
+const (
+	AliasLatest       = "latest"
+	AliasLatestStable = "latest-stable"
+	AliasStable       = "stable"
+)
+
+// Constraint is a version constraint:
+//
+//   - latest (the newest version, including pre-releases)
+//   - latest-stable, stable (the newest release)
+//   - exact version: v3.12.3, 3.12.3, v4.0.0-rc1, v21.1, 3.21.1
+//   - partial version: 3, 3.x, 3.12, 3.12.*
+//   - tilde/caret ranges: ~3.12 (>=3.12.0 <3.13.0), ^3.12 (>=3.12.0 <4.0.0)
+//   - comparisons: >=3.19 <4, >3.12.0, !=3.12.2 (space or comma separated)
+//   - any of the above joined by "||"
+//
+// Pre-releases match only "latest" or a constraint mentioning a pre-release
+// (any constraint except "stable" if IncludePrereleases is set).
+// Versions 3.21+ are treated as the new versioning scheme (3.21.5 is v21.5).
+// Releases after v3.20 are v21+, so "<4" does not match them, "<3.23" (which
+// is "<23") matches both v3.x and v21-v22.
+type Constraint struct {
+	raw        string
+	exact      string
+	prerelease bool
+	groups     [][]condition
+}
+
+type condition struct {
+	op string
+	v  Version
+}
+
+var opRe = regexp.MustCompile(`^(>=|<=|!=|==|=|>|<|~|\^)?\s*(.+)$`)
+
+// IncludePrereleases allows pre-releases for all constraints except "stable"
+var IncludePrereleases bool
+
+// ParseConstraint parses a version constraint
+func ParseConstraint(s string) (*Constraint, error) {
+	s = strings.TrimSpace(s)
+	c := &Constraint{raw: s, prerelease: IncludePrereleases}
+
+	switch strings.ToLower(s) {
+	case "":
+		return nil, errors.New("Version is empty")
+	case AliasLatest:
+		c.prerelease = true
+		c.groups = [][]condition{{}}
+		return c, nil
+	case AliasLatestStable, AliasStable:
+		c.prerelease = false
+		c.groups = [][]condition{{}}
+		return c, nil
+	}
+
+	// an exact version (tag) is used as is
+	if v, err := ParseVersion(s); err == nil && isFullVersion(v) {
+		c.exact = exactTag(s, v)
+		c.prerelease = v.IsPrerelease()
+		c.groups = [][]condition{{{op: "=", v: v.normalize()}}}
+		return c, nil
+	}
+
+	for _, group := range strings.Split(s, "||") {
+		conds := []condition{}
+		for _, term := range splitTerms(group) {
+			parsed, err := parseTerm(term)
+			if err != nil {
+				return nil, fmt.Errorf("Version constraint is incorrect: %s (%v)", s, err)
+			}
+			for _, p := range parsed {
+				if p.v.IsPrerelease() {
+					c.prerelease = true
+				}
+				conds = append(conds, p)
+			}
+		}
+		if len(conds) == 0 {
+			return nil, errors.New("Version constraint is incorrect: " + s)
+		}
+		c.groups = append(c.groups, conds)
+	}
+	return c, nil
+}
+
+// splitTerms splits "<op> <version>" terms, allowing a space after an operator
+func splitTerms(group string) []string {
+	fields := strings.Fields(strings.Replace(group, ",", " ", -1))
+	res := []string{}
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if opRe.MatchString(f) && strings.Trim(f, "<>=!~^") == "" && i+1 < len(fields) {
+			f += fields[i+1]
+			i++
+		}
+		res = append(res, f)
+	}
+	return res
+}
+
+// parseTerm converts a single term into conditions
+func parseTerm(term string) ([]condition, error) {
+	m := opRe.FindStringSubmatch(term)
+	if m == nil {
+		return nil, errors.New("unknown term " + term)
+	}
+	op := m[1]
+	v, wildcard, err := parseVersion(m[2])
+	if err != nil {
+		return nil, err
+	}
+
+	if op == "" && !isFullVersion(v) || wildcard && (op == "" || op == "=" || op == "==") {
+		op = "~"
+	}
+
+	var res []condition
+	switch op {
+	case "~":
+		res = []condition{{">=", v}, {"<", upperBound(v, v.Parts == 1)}}
+	case "^":
+		res = []condition{{">=", v}, {"<", upperBound(v, true)}}
+	case "==", "":
+		res = []condition{{"=", v}}
+	default:
+		res = []condition{{op, v}}
+	}
+	for i := range res {
+		res[i].v = res[i].v.normalize()
+	}
+	return res, nil
+}
+
+// isFullVersion returns true if the version is a complete tag: v3.12.3,
+// v4.0.0-rc1 or v21.1 (the new versioning scheme)
+func isFullVersion(v Version) bool {
+	return v.Parts == 3 || v.IsPrerelease() || v.Parts == 2 && v.Major >= 21
+}
+
+// upperBound returns the next major (or minor) version
+func upperBound(v Version, major bool) Version {
+	res := Version{Major: v.Major + 1, Parts: 3}
+	if !major {
+		res = Version{Major: v.Major, Minor: v.Minor + 1, Parts: 3}
+	}
+	res.Original = fmt.Sprintf("%d.%d.%d", res.Major, res.Minor, res.Patch)
+	return res
+}
+
+// exactTag returns a tag for an exact version (adds "v" prefix if needed)
+func exactTag(s string, v Version) string {
+	n := v.normalize()
+	if n.Parts != v.Parts {
+		tag := fmt.Sprintf("v%d.%d", n.Major, n.Minor)
+		if n.Pre != "" {
+			tag += "-" + n.Pre
+		}
+		return tag
+	}
+	return "v" + strings.TrimPrefix(strings.TrimSpace(s), "v")
+}
+
+func (c *Constraint) String() string {
+	return c.raw
+}
+
+// Exact returns a tag if the constraint is an exact version
+func (c *Constraint) Exact() (string, bool) {
+	return c.exact, c.exact != ""
+}
+
+// Match returns true if the version satisfies the constraint
+func (c *Constraint) Match(v Version) bool {
+	if v.IsPrerelease() && !c.prerelease {
+		return false
+	}
+	for _, group := range c.groups {
+		if matchAll(group, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAll(conds []condition, v Version) bool {
+	for _, cond := range conds {
+		if !cond.match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cond condition) match(v Version) bool {
+	c := v.Compare(cond.v)
+	switch cond.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<=":
+		return c <= 0
+	case "<":
+		// <4 should not match 4.0.0-rc1
+		if !cond.v.IsPrerelease() && v.IsPrerelease() &&
+			v.Major == cond.v.Major && v.Minor == cond.v.Minor && v.Patch == cond.v.Patch {
+			return false
+		}
+		return c < 0
+	}
+	return false
+}
+
+// ResolveConstraint returns the newest of versions (tags) matching the constraint
+func ResolveConstraint(constraint string, versions []string) (string, error) {
+	c, err := ParseConstraint(constraint)
+	if err != nil {
+		return "", err
+	}
+
+	var best *Version
+	for _, s := range versions {
+		v, err := ParseVersion(s)
+		if err != nil || !c.Match(v) {
+			continue
+		}
+		if best == nil || best.Less(v) {
+			found := v
+			best = &found
+		}
+	}
+	if best == nil {
+		return "", NewError(ErrNotFound, "No version matches %s", constraint)
+	}
+	return best.Original, nil
+}
+
+// ResolveInstalledVersion returns the newest installed version matching the
+// constraint (an exact version is returned as is, even if not installed)
+func ResolveInstalledVersion(app, constraint string) (string, error) {
+	c, err := ParseConstraint(constraint)
+	if err != nil {
+		return "", err
+	}
+	if tag, ok := c.Exact(); ok {
+		return tag, nil
+	}
+
+	versions, err := ListInstalledVersions(app)
+	if err != nil {
+		return "", err
+	}
+	tags := make([]string, 0, len(versions))
+	for _, v := range versions {
+		if !v.Partial {
+			tags = append(tags, v.Version)
+		}
+	}
+	tag, err := ResolveConstraint(constraint, tags)
+	if err != nil {
+		return "", NewError(ErrNotInstalled, "No installed version matches %s", constraint)
+	}
+	return tag, nil
+}
+
+// ResolveRemoteVersion returns the newest released version matching the
+// constraint (an exact version is returned as is, without requests)
+func ResolveRemoteVersion(ctx context.Context, src ReleaseSource, constraint string) (string, error) {
+	c, err := ParseConstraint(constraint)
+	if err != nil {
+		return "", err
+	}
+	if tag, ok := c.Exact(); ok {
+		return tag, nil
+	}
+
+	releases, err := ListAllReleases(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	tags := make([]string, 0, len(releases))
+	for _, r := range releases {
+		tags = append(tags, r.Tag)
+	}
+	return ResolveConstraint(constraint, tags)
+}
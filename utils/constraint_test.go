@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// releasedTags are tags of both numbering schemes with pre-releases
+var releasedTags = []string{
+	"v3.9.0", "v3.12.2", "v3.12.3", "v3.12.4", "v3.20.3",
+	"v4.0.0-rc1", "v21.0-rc1", "v21.1", "v21.12", "v22.0-rc1",
+}
+
+func TestResolveConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		want       string
+	}{
+		{"latest", "v22.0-rc1"},
+		{"latest-stable", "v21.12"},
+		{"stable", "v21.12"},
+		{"3", "v3.20.3"},
+		{"3.x", "v3.20.3"},
+		{"3.12", "v3.12.4"},
+		{"3.12.*", "v3.12.4"},
+		{"~3.12", "v3.12.4"},
+		{"~3.12.3", "v3.12.4"},
+		{"^3.12", "v3.20.3"},
+		{">=3.19 <4", "v3.20.3"},
+		// the new scheme is v21+, not v4+
+		{">=3.19 <3.21", "v3.20.3"},
+		{">=3.19 <3.22", "v21.12"},
+		{"<3.23", "v21.12"},
+		{">3.20 <22", "v21.12"},
+		{">=3.19, <4", "v3.20.3"},
+		{">= 3.19 < 4", "v3.20.3"},
+		{">3.9.0 <3.12.3", "v3.12.2"},
+		{"3.12 !=3.12.4", "v3.12.3"},
+		{"3.9 || 3.12", "v3.12.4"},
+		{"v3.12.3", "v3.12.3"},
+		{"3.12.3", "v3.12.3"},
+		// the new numbering scheme
+		{"21", "v21.12"},
+		{"21.x", "v21.12"},
+		{"v21.1", "v21.1"},
+		{"3.21", "v21.12"},
+		{"3.21.1", "v21.1"},
+		{">=3.20", "v21.12"},
+		{"<22", "v21.12"},
+		// pre-releases match only if mentioned
+		{"<4", "v3.20.3"},
+		{"v4.0.0-rc1", "v4.0.0-rc1"},
+		{">=4.0.0-rc1 <5", "v4.0.0-rc1"},
+		{"v22.0-rc1", "v22.0-rc1"},
+	}
+	for _, tt := range tests {
+		got, err := ResolveConstraint(tt.constraint, releasedTags)
+		if err != nil {
+			t.Errorf("%q: %v", tt.constraint, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.constraint, got, tt.want)
+		}
+	}
+}
+
+func TestResolveConstraintNotFound(t *testing.T) {
+	for _, c := range []string{"4.x", "5.x", "~3.13", "v3.12.5", ">22", "3.21.2"} {
+		if got, err := ResolveConstraint(c, releasedTags); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%q: got %s (%v), want ErrNotFound", c, got, err)
+		}
+	}
+}
+
+func TestResolveConstraintPrereleases(t *testing.T) {
+	defer func(old bool) { IncludePrereleases = old }(IncludePrereleases)
+	IncludePrereleases = true
+
+	tests := []struct {
+		constraint string
+		want       string
+	}{
+		{"latest", "v22.0-rc1"},
+		{"stable", "v21.12"},
+		{">3.20 <5", "v4.0.0-rc1"},
+		{">21.12", "v22.0-rc1"},
+		{"21", "v21.12"},
+	}
+	for _, tt := range tests {
+		got, err := ResolveConstraint(tt.constraint, releasedTags)
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %s (%v), want %s", tt.constraint, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseConstraint(t *testing.T) {
+	tests := []struct {
+		s     string
+		exact string
+	}{
+		{"v3.12.3", "v3.12.3"},
+		{"3.12.3", "v3.12.3"},
+		{"v4.0.0-rc1", "v4.0.0-rc1"},
+		{"v21.1", "v21.1"},
+		{"21.1", "v21.1"},
+		{"3.21.1", "v21.1"},
+		{"3.21.0-rc2", "v21.0-rc2"},
+		{"3.12", ""},
+		{"21", ""},
+		{"latest", ""},
+		{"~3.12.3", ""},
+	}
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.s)
+		if err != nil {
+			t.Errorf("%q: %v", tt.s, err)
+			continue
+		}
+		if exact, _ := c.Exact(); exact != tt.exact {
+			t.Errorf("%q: got exact %q, want %q", tt.s, exact, tt.exact)
+		}
+	}
+
+	for _, s := range []string{"", "abc", ">=", "3.x-rc1", "3.12 ||"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestResolveRemoteVersion(t *testing.T) {
+	src := newFakeSource("v22.0-rc1", "v21.12", "v21.1", "v4.0.0-rc1", "v3.20.3", "v3.12.4", "v3.12.3")
+
+	tests := []struct {
+		constraint string
+		want       string
+		calls      int
+	}{
+		{"latest", "v22.0-rc1", 1},
+		{"stable", "v21.12", 1},
+		{"3.x", "v3.20.3", 1},
+		{"~3.12", "v3.12.4", 1},
+		{">=3.19 <4", "v3.20.3", 1},
+		{">=3.19 <3.22", "v21.12", 1},
+		{"21", "v21.12", 1},
+		// exact versions are resolved without requests
+		{"v3.12.3", "v3.12.3", 0},
+		{"3.21.1", "v21.1", 0},
+		{"v9.9.9", "v9.9.9", 0},
+	}
+	for _, tt := range tests {
+		src.calls = 0
+		got, err := ResolveRemoteVersion(context.Background(), src, tt.constraint)
+		if err != nil {
+			t.Errorf("%s: %v", tt.constraint, err)
+			continue
+		}
+		if got != tt.want || src.calls != tt.calls {
+			t.Errorf("%s: got %s (%d requests), want %s (%d requests)",
+				tt.constraint, got, src.calls, tt.want, tt.calls)
+		}
+	}
+
+	if _, err := ResolveRemoteVersion(context.Background(), src, "5.x"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("5.x: got %v, want ErrNotFound", err)
+	}
+}
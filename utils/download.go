@@ -0,0 +1,313 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default settings of the downloader
+const (
+	DefaultRetries     = 3
+	DefaultBackoff     = 2 * time.Second
+	DefaultIdleTimeout = time.Minute
+)
+
+// NewHTTPTransport returns a transport with sane timeouts which honours
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY env variables
+func NewHTTPTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// Downloader downloads assets into a temp file (".part") which is renamed
+// into the destination only when the download is complete. An interrupted
+// download is resumed, failed attempts are retried with exponential backoff.
+type Downloader struct {
+	// Retries is a number of retries after the first attempt
+	Retries int
+	// Backoff is a delay before the first retry (doubled for the next ones)
+	Backoff time.Duration
+	// IdleTimeout cancels an attempt if no data is received (0 - no timeout)
+	IdleTimeout time.Duration
+	// Progress is used to show a progress bar (nil - no progress)
+	Progress io.Writer
+}
+
+// NewDownloader returns a downloader with default settings, progress is shown
+// on stderr if it is a terminal
+func NewDownloader() *Downloader {
+	dl := &Downloader{
+		Retries:     DefaultRetries,
+		Backoff:     DefaultBackoff,
+		IdleTimeout: DefaultIdleTimeout,
+	}
+	if IsTerminal(os.Stderr) {
+		dl.Progress = os.Stderr
+	}
+	return dl
+}
+
+// IsTerminal returns true if the file is a terminal
+func IsTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+// Download downloads an asset into dest
+func (dl *Downloader) Download(ctx context.Context, src ReleaseSource, asset Asset, dest string) error {
+	part := dest + ".part"
+	backoff := dl.Backoff
+
+	var err error
+	for attempt := 0; attempt <= dl.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		err = dl.attempt(ctx, src, asset, part)
+		if err == nil {
+			return os.Rename(part, dest)
+		}
+		if !isRetriable(err) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	// keep a partially downloaded file to resume next time
+	if st, statErr := os.Stat(part); statErr == nil && st.Size() == 0 {
+		os.Remove(part)
+	}
+	return err
+}
+
+// attempt downloads (or resumes downloading of) an asset into the part file
+func (dl *Downloader) attempt(ctx context.Context, src ReleaseSource, asset Asset, part string) error {
+	out, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	st, err := out.Stat()
+	if err != nil {
+		return err
+	}
+	offset := st.Size()
+	size := int64(asset.Size)
+	if size > 0 && offset > size {
+		// garbage from a previous download, start over
+		if err := out.Truncate(0); err != nil {
+			return err
+		}
+		offset = 0
+	}
+	if size > 0 && offset == size {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	in, err := src.OpenAsset(ctx, asset, offset)
+	var httpErr *HTTPError
+	if offset > 0 && errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// the part file does not match the asset, start over
+		if err := out.Truncate(0); err != nil {
+			return err
+		}
+		offset = 0
+		in, err = src.OpenAsset(ctx, asset, offset)
+	}
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if s, ok := in.(*sizedBody); ok && s.size > 0 {
+		if size > 0 && s.size != size {
+			return NewError(ErrNetwork, "Size of %s is %d bytes, expected %d",
+				asset.Name, s.size, size)
+		}
+		size = s.size
+	}
+
+	var r io.Reader = in
+	if dl.IdleTimeout > 0 {
+		r = newIdleReader(r, dl.IdleTimeout, cancel)
+	}
+	if dl.Progress != nil && offset != size {
+		bar := &progressBar{w: dl.Progress, name: asset.Name, total: size, done: offset}
+		r = io.TeeReader(r, bar)
+		defer bar.finish()
+	}
+
+	n, err := io.Copy(out, r)
+	offset += n
+	if err != nil {
+		return &Error{Kind: ErrNetwork, Msg: "Could not download " + asset.Name, Err: err}
+	}
+
+	if size > 0 && offset != size {
+		return NewError(ErrNetwork, "Download of %s is incomplete: %d of %d bytes",
+			asset.Name, offset, size)
+	}
+	return nil
+}
+
+// sizedBody is a stream of an asset with the asset's total size known from
+// response headers (Content-Length, Content-Range), size is -1 if unknown
+type sizedBody struct {
+	io.ReadCloser
+	size int64
+}
+
+// contentRangeSize returns a total size from Content-Range header
+// ("bytes 0-99/200", "bytes */200")
+func contentRangeSize(header string) (int64, bool) {
+	i := strings.LastIndex(header, "/")
+	if i < 0 {
+		return -1, false
+	}
+	size, err := strconv.ParseInt(header[i+1:], 10, 64)
+	if err != nil {
+		return -1, false
+	}
+	return size, true
+}
+
+// isRetriable returns false for errors which do not disappear after a retry
+func isRetriable(err error) bool {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrPermission),
+		errors.Is(err, ErrOffline):
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 500 || httpErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// HTTPError is returned for unexpected HTTP responses
+type HTTPError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return "unexpected response for " + e.URL + ": " + e.Status
+}
+
+// Is reports whether the error is of the target kind
+func (e *HTTPError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrPermission:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrNetwork:
+		return true
+	}
+	return false
+}
+
+// idleReader cancels reading if no data is received during the timeout
+type idleReader struct {
+	r     io.Reader
+	timer *time.Timer
+	d     time.Duration
+}
+
+func newIdleReader(r io.Reader, d time.Duration, cancel func()) *idleReader {
+	return &idleReader{r: r, d: d, timer: time.AfterFunc(d, cancel)}
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.d)
+	}
+	if err != nil {
+		r.timer.Stop()
+	}
+	return n, err
+}
+
+// progressBar renders download progress in a terminal
+type progressBar struct {
+	sync.Mutex
+	w     io.Writer
+	name  string
+	total int64
+	done  int64
+	last  time.Time
+}
+
+func (b *progressBar) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	b.done += int64(len(p))
+	if time.Since(b.last) > 100*time.Millisecond {
+		b.render()
+	}
+	return len(p), nil
+}
+
+func (b *progressBar) render() {
+	b.last = time.Now()
+	const width = 30
+	if b.total <= 0 {
+		fmt.Fprintf(b.w, "\r%s %s", b.name, formatBytes(b.done))
+		return
+	}
+	filled := int(b.done * width / b.total)
+	if filled > width {
+		filled = width
+	}
+	fmt.Fprintf(b.w, "\r%s [%s%s] %3d%% %s/%s", b.name,
+		strings.Repeat("=", filled), strings.Repeat(" ", width-filled),
+		b.done*100/b.total, formatBytes(b.done), formatBytes(b.total))
+}
+
+func (b *progressBar) finish() {
+	b.Lock()
+	defer b.Unlock()
+	b.render()
+	fmt.Fprintln(b.w)
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloaderResume(t *testing.T) {
+	content := []byte(strings.Repeat("protoc", 1000))
+	ranges := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "protoc.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "pbvm-download-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name   string
+		part   []byte
+		size   int
+		ranges []string
+	}{
+		{"no part", nil, len(content), []string{""}},
+		{"resumed", content[:100], len(content), []string{"bytes=100-"}},
+		{"resumed, unknown size", content[:100], 0, []string{"bytes=100-"}},
+		{"complete", content, len(content), []string{}},
+		{"complete, unknown size", content, 0, []string{"bytes=6000-"}},
+		{"garbage, unknown size", append(content, 'x'), 0, []string{"bytes=6001-", ""}},
+	}
+	src := NewGitHubSource("owner", "repo", SourceOptions{})
+	dl := &Downloader{}
+	for _, tt := range tests {
+		ranges = []string{}
+		dest := filepath.Join(dir, "protoc.zip")
+		os.Remove(dest)
+		if tt.part != nil {
+			if err := ioutil.WriteFile(dest+".part", tt.part, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		asset := Asset{Name: "protoc.zip", Size: tt.size, URL: srv.URL + "/protoc.zip"}
+		if err := dl.Download(context.Background(), src, asset, dest); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		got, err := ioutil.ReadFile(dest)
+		if err != nil || !bytes.Equal(got, content) {
+			t.Errorf("%s: got %d bytes (%v), want %d", tt.name, len(got), err, len(content))
+		}
+		if strings.Join(ranges, ",") != strings.Join(tt.ranges, ",") {
+			t.Errorf("%s: got requests %q, want %q", tt.name, ranges, tt.ranges)
+		}
+	}
+}
+
+func TestContentRangeSize(t *testing.T) {
+	tests := []struct {
+		header string
+		size   int64
+		ok     bool
+	}{
+		{"bytes 0-99/200", 200, true},
+		{"bytes */200", 200, true},
+		{"bytes 0-99/*", -1, false},
+		{"", -1, false},
+	}
+	for _, tt := range tests {
+		size, ok := contentRangeSize(tt.header)
+		if size != tt.size || ok != tt.ok {
+			t.Errorf("%q: got %d %v, want %d %v", tt.header, size, ok, tt.size, tt.ok)
+		}
+	}
+}
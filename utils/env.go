@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Env variables set for a command running under a version
+const (
+	EnvProtoc        = "PROTOC"
+	EnvProtocInclude = "PROTOC_INCLUDE"
+)
+
+// GetExecutableName returns name of the executable for current OS
+func GetExecutableName(name string) string {
+	if runtime.GOOS == "windows" && !strings.HasSuffix(strings.ToLower(name), ".exe") {
+		return name + ".exe"
+	}
+	return name
+}
+
+// GetProtocPath returns path to the protoc binary of a version
+func GetProtocPath(app, version string) (string, error) {
+	versionDir, err := GetHomeVersionDir(app, version)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(versionDir, "bin", GetExecutableName("protoc")), nil
+}
+
+// VersionEnv returns a copy of environ prepared for running commands under
+// a version: version's bin dir is prepended to PATH, PROTOC, PROTOC_INCLUDE
+// and <APP>_VERSION are set. Global active version is not affected.
+func VersionEnv(app, version string, environ []string) ([]string, error) {
+	versionDir, err := GetHomeVersionDir(app, version)
+	if err != nil {
+		return nil, err
+	}
+	protoc, err := GetProtocPath(app, version)
+	if err != nil {
+		return nil, err
+	}
+
+	binDir := filepath.Join(versionDir, "bin")
+	pathEnv := binDir
+	if p := GetEnv(environ, "PATH"); p != "" {
+		pathEnv += string(os.PathListSeparator) + p
+	}
+
+	env := SetEnv(environ, "PATH", pathEnv)
+	env = SetEnv(env, EnvProtoc, protoc)
+	env = SetEnv(env, EnvProtocInclude, filepath.Join(versionDir, "include"))
+	env = SetEnv(env, GetVersionEnvName(app), version)
+	return env, nil
+}
+
+// GetEnv returns value of the key from environ ("key=value" list)
+func GetEnv(environ []string, key string) string {
+	for _, kv := range environ {
+		if k, v := splitEnv(kv); sameEnvKey(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// SetEnv returns a copy of environ ("key=value" list) with the key set
+func SetEnv(environ []string, key, value string) []string {
+	res := make([]string, 0, len(environ)+1)
+	for _, kv := range environ {
+		if k, _ := splitEnv(kv); sameEnvKey(k, key) {
+			continue
+		}
+		res = append(res, kv)
+	}
+	return append(res, key+"="+value)
+}
+
+func splitEnv(kv string) (string, string) {
+	// skip the first char: on windows there are variables like "=C:=C:\"
+	if len(kv) > 0 {
+		if i := strings.Index(kv[1:], "="); i >= 0 {
+			return kv[:i+1], kv[i+2:]
+		}
+	}
+	return kv, ""
+}
+
+func sameEnvKey(a, b string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// LookPath searches for an executable in PATH of environ (unlike exec.LookPath
+// which uses PATH of the current process)
+func LookPath(name string, environ []string) (string, error) {
+	if strings.ContainsRune(name, os.PathSeparator) || strings.ContainsRune(name, '/') {
+		return name, nil
+	}
+
+	exts := []string{""}
+	if runtime.GOOS == "windows" {
+		exts = append(exts, strings.Split(strings.ToLower(GetEnv(environ, "PATHEXT")), ";")...)
+	}
+	for _, dir := range filepath.SplitList(GetEnv(environ, "PATH")) {
+		if dir == "" {
+			dir = "."
+		}
+		for _, ext := range exts {
+			file := filepath.Join(dir, name+ext)
+			if isExecutable(file) {
+				return file, nil
+			}
+		}
+	}
+	return "", errors.New("Executable not found in PATH: " + name)
+}
+
+func isExecutable(file string) bool {
+	st, err := os.Stat(file)
+	if err != nil || st.IsDir() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	return st.Mode()&0111 != 0
+}
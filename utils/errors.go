@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+)
+
+// Kinds of errors (use errors.Is to check a kind of an error)
+var (
+	ErrNotInstalled     = errors.New("version is not installed")
+	ErrNotFound         = errors.New("version is not found")
+	ErrNoAsset          = errors.New("no suitable asset")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrNetwork          = errors.New("network error")
+	ErrPermission       = errors.New("permission denied")
+	ErrRateLimit        = errors.New("rate limit exceeded")
+	ErrLocked           = errors.New("lock is held by another process")
+	ErrInvalid          = errors.New("invalid argument")
+)
+
+// Error is an error of a certain kind with a human friendly message
+type Error struct {
+	Kind error
+	Msg  string
+	Err  error
+}
+
+// NewError returns an error of a kind with a formatted message
+func NewError(kind error, format string, args ...interface{}) *Error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Msg + ": " + e.Err.Error()
+	}
+	return e.Msg
+}
+
+// Is reports whether the error is of the target kind
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Unwrap returns the cause of the error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error is a checksum mismatch
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+// Is reports whether the error is a rate limit error
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimit
+}
+
+// KindOf returns a kind of the error (one of Err* variables) or nil
+// if the kind is unknown
+func KindOf(err error) error {
+	kinds := []error{
+		ErrNotInstalled,
+		ErrNotFound,
+		ErrNoAsset,
+		ErrChecksumMismatch,
+		ErrRateLimit,
+		ErrNetwork,
+		ErrPermission,
+		ErrLocked,
+	}
+	for _, k := range kinds {
+		if errors.Is(err, k) {
+			return k
+		}
+	}
+
+	var urlErr *url.Error
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrOffline), errors.As(err, &urlErr), errors.As(err, &netErr):
+		return ErrNetwork
+	case errors.Is(err, os.ErrPermission):
+		return ErrPermission
+	}
+	return nil
+}
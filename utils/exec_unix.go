@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package utils
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ExecCommand replaces the current process with an executable, so signals
+// and the terminal go to it directly. Returns only on failure.
+func ExecCommand(bin string, args, env []string) (int, error) {
+	err := syscall.Exec(bin, append([]string{bin}, args...), env)
+	return 0, err
+}
+
+// inForeground returns true if the process belongs to the foreground process
+// group of its terminal (so the terminal signals the whole group)
+func inForeground() bool {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return false
+	}
+	defer tty.Close()
+	var pgrp int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, tty.Fd(),
+		uintptr(syscall.TIOCGPGRP), uintptr(unsafe.Pointer(&pgrp)))
+	return errno == 0 && int(pgrp) == syscall.Getpgrp()
+}
@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package utils
+
+// ExecCommand runs an executable and returns its exit code (there is no
+// exec on Windows, so the process stays as a parent, see RunCommand)
+func ExecCommand(bin string, args, env []string) (int, error) {
+	return RunCommand(bin, args, env)
+}
+
+// inForeground returns true: Ctrl-C is delivered to all processes of
+// the console
+func inForeground() bool {
+	return true
+}
@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// homeDir and xdgHome are set by SetHome
+var homeDir string
+var xdgHome bool
+
+// GetHomeEnv returns a name of the environment variable with home dir for app
+func GetHomeEnv(app string) string {
+	return strings.ToUpper(app) + "_HOME"
+}
+
+// SetHome sets home dir used by all GetHome* helpers. Empty dir means
+// the <APP>_HOME environment variable or the default ~/.<app>. If xdg is set
+// and home dir is not, data, cache and state are split into XDG base dirs.
+func SetHome(dir string, xdg bool) {
+	homeDir = dir
+	xdgHome = xdg
+}
+
+// homeDirs returns data (versions, plugins, active, etc), cache (release
+// metadata) and state (locks) dirs for app
+func homeDirs(app string) (string, string, string, error) {
+	dir := homeDir
+	if dir == "" {
+		dir = os.Getenv(GetHomeEnv(app))
+	}
+	if dir != "" {
+		dir, err := expandHome(dir)
+		if err != nil {
+			return "", "", "", err
+		}
+		return dir, path.Join(dir, "cache"), path.Join(dir, "locks"), nil
+	}
+
+	if !xdgHome {
+		dir, err := GetDefaultHomeDir(app)
+		return dir, path.Join(dir, "cache"), path.Join(dir, "locks"), err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", "", err
+	}
+	data := path.Join(xdgDir("XDG_DATA_HOME", home, ".local/share"), app)
+	cache := path.Join(xdgDir("XDG_CACHE_HOME", home, ".cache"), app)
+	state := path.Join(xdgDir("XDG_STATE_HOME", home, ".local/state"), app, "locks")
+	return data, cache, state, nil
+}
+
+// xdgDir returns a XDG base dir (env or its default relative to home)
+func xdgDir(env, home, def string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	return path.Join(home, def)
+}
+
+// expandHome expands leading "~" and makes dir absolute
+func expandHome(dir string) (string, error) {
+	if dir == "~" || strings.HasPrefix(dir, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = home + dir[1:]
+	}
+	return filepath.Abs(dir)
+}
+
+// GetDefaultHomeDir returns the default home dir for app (~/.<app>)
+func GetDefaultHomeDir(app string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(home, "."+app), nil
+}
+
+// MigrateHome moves a home tree (from) into the current home dir (see SetHome).
+// Cache is moved into the cache dir, locks are dropped. Absolute symlinks
+// pointing into the old tree are rewritten as relative ones. No other
+// process should use both trees meanwhile.
+func MigrateHome(app, from string, d func(ms ...interface{})) (string, error) {
+	from, err := expandHome(from)
+	if err != nil {
+		return "", err
+	}
+	to, cacheDir, _, err := homeDirs(app)
+	if err != nil {
+		return "", err
+	}
+	if filepath.Clean(from) == filepath.Clean(to) {
+		return "", fmt.Errorf("Home dir is %s already", to)
+	}
+	if isInside(from, to) {
+		return "", fmt.Errorf("Home dir %s is inside of %s", to, from)
+	}
+	if !isDir(from) {
+		return "", NewError(ErrNotFound, "Home dir %s is not found", from)
+	}
+	if files, err := ioutil.ReadDir(to); err == nil && len(files) > 0 {
+		return "", fmt.Errorf("Home dir %s is not empty", to)
+	}
+
+	// locks are meaningful only while a process runs
+	if err := os.RemoveAll(path.Join(from, "locks")); err != nil {
+		return "", err
+	}
+
+	d("Moving", from, "to", to, " ...")
+	if err := os.Remove(to); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if err := moveTree(from, to); err != nil {
+		return "", err
+	}
+
+	if oldCache := path.Join(to, "cache"); cacheDir != oldCache && isDir(oldCache) {
+		d("Moving", oldCache, "to", cacheDir, " ...")
+		if err := os.RemoveAll(cacheDir); err != nil {
+			return "", err
+		}
+		if err := moveTree(oldCache, cacheDir); err != nil {
+			return "", err
+		}
+	}
+
+	d("Fixing links ...")
+	return to, fixLinks(to, from)
+}
+
+// isInside returns true if file is inside of dir
+func isInside(dir, file string) bool {
+	rel, err := filepath.Rel(dir, file)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// moveTree renames src into dst, a tree is copied (and removed) if it
+// could not be renamed (another device)
+func moveTree(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := copyTree(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// copyTree copies a dir preserving modes and symlinks
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(file)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		default:
+			return copyFile(file, target, info.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// fixLinks rewrites absolute symlinks in dir pointing into the old dir
+// as relative ones
+func fixLinks(dir, old string) error {
+	return filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return err
+		}
+		link, err := os.Readlink(file)
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(link) || !isInside(old, link) {
+			return nil
+		}
+		rel, err := filepath.Rel(old, link)
+		if err != nil {
+			return err
+		}
+		target, err := filepath.Rel(filepath.Dir(file), filepath.Join(dir, rel))
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		return os.Symlink(target, file)
+	})
+}
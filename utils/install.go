@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ManifestName is a name of the install manifest in a version dir
+const ManifestName = ".install.json"
+
+// InstallState is a state of a version installation
+type InstallState int
+
+// States of a version installation
+const (
+	// NotInstalled means there is no version dir
+	NotInstalled InstallState = iota
+	// PartiallyInstalled means there is a version dir without a manifest
+	// (an interrupted installation)
+	PartiallyInstalled
+	// Installed means the version is installed and validated
+	Installed
+)
+
+// InstallManifest is written into a version dir after a successful install
+type InstallManifest struct {
+	Version     string    `json:"version"`
+	Platform    string    `json:"platform,omitempty"`
+	Asset       string    `json:"asset,omitempty"`
+	URL         string    `json:"url,omitempty"`
+	SHA256      string    `json:"sha256,omitempty"`
+	InstalledAt time.Time `json:"installed_at"`
+	Files       []string  `json:"files,omitempty"`
+}
+
+// GetInstallState returns an install state of a version and its dir. It is
+// a cheap check (called by shims): a version installed before manifests
+// were introduced is treated as installed if it has protoc executable,
+// AdoptInstall validates it once.
+func GetInstallState(app, version string) (InstallState, string, error) {
+	versionDir, err := GetHomeVersionDir(app, version)
+	if err != nil {
+		return NotInstalled, versionDir, err
+	}
+
+	if _, err := os.Stat(versionDir); os.IsNotExist(err) {
+		return NotInstalled, versionDir, nil
+	} else if err != nil {
+		return NotInstalled, versionDir, err
+	}
+
+	if _, err := os.Stat(filepath.Join(versionDir, ManifestName)); err == nil {
+		return Installed, versionDir, nil
+	} else if !os.IsNotExist(err) {
+		return NotInstalled, versionDir, err
+	}
+
+	if !isExecutable(filepath.Join(versionDir, "bin", GetExecutableName("protoc"))) {
+		return PartiallyInstalled, versionDir, nil
+	}
+	return Installed, versionDir, nil
+}
+
+// HasManifest returns true if a version dir has the install manifest
+func HasManifest(versionDir string) bool {
+	_, err := os.Stat(filepath.Join(versionDir, ManifestName))
+	return err == nil
+}
+
+// AdoptInstall validates a version dir installed before manifests were
+// introduced and writes its manifest (the caller holds the version's lock).
+// Nothing is done if the manifest exists already. A broken version is
+// reported as ErrNotInstalled.
+func AdoptInstall(versionDir, version string) error {
+	if _, err := os.Stat(filepath.Join(versionDir, ManifestName)); !os.IsNotExist(err) {
+		return err
+	}
+	if err := ValidateInstall(versionDir, version); err != nil {
+		return &Error{Kind: ErrNotInstalled, Msg: "Version " + version + " is broken", Err: err}
+	}
+	return WriteManifest(versionDir, InstallManifest{Version: version, InstalledAt: time.Now()})
+}
+
+// ReadManifest reads the install manifest of a version dir
+func ReadManifest(versionDir string) (*InstallManifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(versionDir, ManifestName))
+	if err != nil {
+		return nil, err
+	}
+	m := &InstallManifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WriteManifest writes the install manifest into a version dir
+func WriteManifest(versionDir string, m InstallManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(versionDir, ManifestName), data, 0644)
+}
+
+var protocVersionRe = regexp.MustCompile(`libprotoc\s+(\S+)`)
+
+// ValidateInstall checks that a dir contains a working protoc of the version
+func ValidateInstall(dir, version string) error {
+	protoc := filepath.Join(dir, "bin", GetExecutableName("protoc"))
+	if !isExecutable(protoc) {
+		return fmt.Errorf("%s is not found or is not executable", protoc)
+	}
+
+	out, err := exec.Command(protoc, "--version").Output()
+	if err != nil {
+		return fmt.Errorf("%s --version failed: %v", protoc, err)
+	}
+	return checkProtocVersion(strings.TrimSpace(string(out)), version)
+}
+
+// checkProtocVersion compares "protoc --version" output with a tag. Tags of
+// the new versioning scheme (v21.1) are reported by protoc as 3.21.1,
+// pre-release suffixes are not reported at all.
+func checkProtocVersion(out, tag string) error {
+	m := protocVersionRe.FindStringSubmatch(out)
+	if m == nil {
+		return fmt.Errorf("unexpected protoc --version output: %q", out)
+	}
+	got, err := ParseVersion(m[1])
+	if err != nil {
+		return fmt.Errorf("unexpected protoc --version output: %q", out)
+	}
+	want, err := ParseVersion(tag)
+	if err != nil {
+		// not a version tag (custom build), nothing to compare
+		return nil
+	}
+
+	got = got.normalize()
+	if got.Major != want.Major || got.Minor != want.Minor || got.Patch != want.Patch {
+		return fmt.Errorf("protoc reports version %s, expected %s", m[1], tag)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ActiveLockName is a name of the global lock guarding activation and shims
+const ActiveLockName = "active"
+
+// lockPollInterval is an interval between attempts to acquire a busy lock
+var lockPollInterval = 100 * time.Millisecond
+
+// lockStaleEmptyAge is an age after which an empty lock file (the owner died
+// before writing its PID) is treated as stale
+const lockStaleEmptyAge = 10 * time.Second
+
+// Lock is an inter-process lock based on a file with the owner's PID
+type Lock struct {
+	path string
+}
+
+// GetHomeLocksDir returns home's locks dir for app
+func GetHomeLocksDir(app string) (string, error) {
+	_, _, locks, err := homeDirs(app)
+	return locks, err
+}
+
+// GetVersionLockName returns a name of the lock guarding a version
+// (install, delete)
+func GetVersionLockName(version string) string {
+	return "version-" + version
+}
+
+// GetPluginLockName returns a name of the lock guarding a plugin version
+func GetPluginLockName(name, version string) string {
+	return "plugin-" + name + "-" + version
+}
+
+// AcquireLock acquires a named lock of app. If the lock is held by another
+// process, then it waits up to timeout (wait is called once with the owner's
+// PID). Locks of dead processes are taken over.
+func AcquireLock(ctx context.Context, app, name string, timeout time.Duration, wait func(pid int)) (*Lock, error) {
+	dir, err := GetHomeLocksDir(app)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	l := &Lock{path: filepath.Join(dir, name+".lock")}
+
+	deadline := time.Now().Add(timeout)
+	waiting := false
+	for {
+		ok, err := l.tryAcquire()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return l, nil
+		}
+
+		pid, stale := lockOwner(l.path)
+		if stale {
+			// the owner is dead, remove its lock and try again
+			if err := l.takeOver(pid); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !time.Now().Before(deadline) {
+			return nil, &Error{
+				Kind: ErrLocked,
+				Msg:  fmt.Sprintf("Lock %s is held by PID %d", l.path, pid),
+			}
+		}
+		if !waiting && pid > 0 {
+			// PID is unknown while the owner is writing it
+			if wait != nil {
+				wait(pid)
+			}
+			waiting = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// Release releases the lock
+func (l *Lock) Release() error {
+	return os.Remove(l.path)
+}
+
+// tryAcquire creates the lock file, returns false if it exists already
+func (l *Lock) tryAcquire() (bool, error) {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = f.WriteString(strconv.Itoa(os.Getpid()))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(l.path)
+		return false, err
+	}
+	return true, nil
+}
+
+// takeOver removes a stale lock of a dead owner (pid). Another waiter could
+// have taken it over and created a fresh lock meanwhile, so the lock file is
+// renamed first and removed only if it still belongs to the dead owner,
+// otherwise it is put back.
+func (l *Lock) takeOver(pid int) error {
+	tmp := fmt.Sprintf("%s.%d-%d", l.path, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(l.path, tmp); err != nil {
+		if os.IsNotExist(err) {
+			// taken over by another waiter
+			return nil
+		}
+		return err
+	}
+	if owner, stale := lockOwner(tmp); stale && owner == pid {
+		return os.Remove(tmp)
+	}
+	// a fresh lock, link fails if the path is taken again (nothing to restore)
+	err := os.Link(tmp, l.path)
+	if rerr := os.Remove(tmp); err == nil {
+		err = rerr
+	}
+	if os.IsExist(err) {
+		return nil
+	}
+	return err
+}
+
+// lockOwner returns PID of the lock file's owner and true if the owner is dead
+func lockOwner(file string) (int, bool) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		// released just now
+		return 0, false
+	}
+	pid, perr := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || perr != nil || pid <= 0 {
+		// the owner could be writing its PID right now
+		info, err := os.Stat(file)
+		return 0, err == nil && time.Since(info.ModTime()) > lockStaleEmptyAge
+	}
+	return pid, pid != os.Getpid() && !processAlive(pid)
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package utils
+
+import "syscall"
+
+// processAlive returns true if a process with pid exists
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// PinFileName is a name of the file with a version pinned for a project
+const PinFileName = ".protoc-version"
+
+// Origins of a resolved version (see ResolveVersion)
+const (
+	OriginFlag   = "flag"
+	OriginEnv    = "env"
+	OriginGlobal = "global"
+)
+
+// GetVersionEnvName returns a name of the env variable with a version for app
+func GetVersionEnvName(app string) string {
+	return strings.ToUpper(app) + "_VERSION"
+}
+
+// GetProjectConfigName returns a name of the project's config for app
+func GetProjectConfigName(app string) string {
+	return "." + app + ".yaml"
+}
+
+// FindPinFile looks for a pinned version walking up from dir. In each
+// directory ".protoc-version" is checked first, then "<app>.lock",
+// "<app>.yaml" (key "protoc", see Project) and ".<app>.yaml" (key "version").
+// Returns empty strings if nothing is found.
+func FindPinFile(app, dir string) (string, string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	for {
+		file := filepath.Join(dir, PinFileName)
+		version, err := readPinFile(file)
+		if err != nil {
+			return "", "", err
+		}
+		if version != "" {
+			return file, version, nil
+		}
+
+		file, version, err = readPinProject(app, dir)
+		if err != nil {
+			return "", "", err
+		}
+		if version != "" {
+			return file, version, nil
+		}
+
+		file = filepath.Join(dir, GetProjectConfigName(app))
+		version, err = readPinConfig(file)
+		if err != nil {
+			return "", "", err
+		}
+		if version != "" {
+			return file, version, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", nil
+		}
+		dir = parent
+	}
+}
+
+// readPinFile returns the first non-empty, non-comment line of the file
+func readPinFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return line, nil
+	}
+	return "", scanner.Err()
+}
+
+// FindProjectConfig looks for the project's config walking up from dir.
+// Returns empty string if nothing is found.
+func FindProjectConfig(app, dir string) (string, error) {
+	dir, err := findUp(dir, GetProjectConfigName(app))
+	if dir == "" || err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, GetProjectConfigName(app)), nil
+}
+
+// readPinConfig returns value of the "version" key of the yaml file
+func readPinConfig(file string) (string, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var cfg struct {
+		Version string `yaml:"version"`
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(cfg.Version), nil
+}
+
+// ResolveVersion returns a version which should be used in the current
+// directory and its origin. A version constraint (see Constraint) is resolved
+// against installed versions. The first found wins:
+//
+//   - explicit version (from a command line flag)
+//   - <APP>_VERSION env variable
+//   - pin file (see FindPinFile), the origin is a path to the file
+//   - globally active version
+func ResolveVersion(app, explicit string) (string, string, error) {
+	version, origin, err := findVersion(app, explicit)
+	if err != nil || origin == OriginGlobal {
+		return version, origin, err
+	}
+
+	tag, err := ResolveInstalledVersion(app, version)
+	if err != nil {
+		return "", "", fmt.Errorf("%w (set by %s)", err, origin)
+	}
+	return tag, origin, nil
+}
+
+// findVersion returns not resolved version (constraint) and its origin
+func findVersion(app, explicit string) (string, string, error) {
+	if explicit != "" {
+		return explicit, OriginFlag, nil
+	}
+
+	if v := strings.TrimSpace(os.Getenv(GetVersionEnvName(app))); v != "" {
+		return v, OriginEnv, nil
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", "", err
+	}
+	file, version, err := FindPinFile(app, cwd)
+	if err != nil {
+		return "", "", err
+	}
+	if version != "" {
+		return version, file, nil
+	}
+
+	version, err = GetActiveVersion(app)
+	if os.IsNotExist(err) {
+		return "", "", errors.New("Version is not set: use a flag, " +
+			GetVersionEnvName(app) + " env variable or " + PinFileName + " file")
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return version, OriginGlobal, nil
+}
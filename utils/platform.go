@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// assetPlatforms maps GOOS/GOARCH to platform names used in protoc assets
+// (protoc-<version>-<platform>.zip). Names changed over time, so all known
+// names are listed in order of preference.
+var assetPlatforms = map[string][]string{
+	"linux/386":     {"linux-x86_32"},
+	"linux/amd64":   {"linux-x86_64"},
+	"linux/arm64":   {"linux-aarch_64"},
+	"linux/ppc64le": {"linux-ppcle_64"},
+	"linux/s390x":   {"linux-s390_64", "linux-s390x"},
+	"darwin/386":    {"osx-x86_32"},
+	"darwin/amd64":  {"osx-x86_64", "osx-universal_binary"},
+	"darwin/arm64":  {"osx-aarch_64", "osx-universal_binary"},
+	"windows/386":   {"win32"},
+	"windows/amd64": {"win64"},
+}
+
+// osAliases and archAliases map names used in assets to GOOS/GOARCH
+var osAliases = map[string]string{
+	"osx":   "darwin",
+	"macos": "darwin",
+	"win":   "windows",
+	"win32": "windows",
+	"win64": "windows",
+}
+
+var archAliases = map[string]string{
+	"x86_64":   "amd64",
+	"x64":      "amd64",
+	"x86_32":   "386",
+	"x86":      "386",
+	"i386":     "386",
+	"aarch_64": "arm64",
+	"aarch64":  "arm64",
+	"ppcle_64": "ppc64le",
+	"s390_64":  "s390x",
+}
+
+// Target is a platform which assets are installed for
+type Target struct {
+	// OS and Arch are GOOS and GOARCH values
+	OS   string
+	Arch string
+	// Rosetta allows x86_64 assets on darwin/arm64 (for old releases
+	// without arm64 builds)
+	Rosetta bool
+}
+
+// HostTarget returns the current platform
+func HostTarget() Target {
+	return Target{OS: runtime.GOOS, Arch: runtime.GOARCH}
+}
+
+// ParseTarget returns a target for OS and arch (empty values mean the host's
+// ones). Both GOOS/GOARCH and asset names (osx, aarch_64, etc) are accepted,
+// an explicitly set platform should be known.
+func ParseTarget(goos, arch string, rosetta bool) (Target, error) {
+	t := HostTarget()
+	t.Rosetta = rosetta
+	if goos != "" {
+		t.OS = strings.ToLower(goos)
+		if alias, ok := osAliases[t.OS]; ok {
+			t.OS = alias
+		}
+	}
+	if arch != "" {
+		t.Arch = strings.ToLower(arch)
+		if alias, ok := archAliases[t.Arch]; ok {
+			t.Arch = alias
+		}
+	}
+	if _, ok := assetPlatforms[t.String()]; !ok && (goos != "" || arch != "") {
+		known := make([]string, 0, len(assetPlatforms))
+		for k := range assetPlatforms {
+			known = append(known, k)
+		}
+		sort.Strings(known)
+		return t, fmt.Errorf("Platform %s is not supported (expected one of: %s)",
+			t, strings.Join(known, ", "))
+	}
+	return t, nil
+}
+
+func (t Target) String() string {
+	return t.OS + "/" + t.Arch
+}
+
+// IsHost returns true if binaries of the target could be run on the host
+func (t Target) IsHost() bool {
+	h := HostTarget()
+	return t.OS == h.OS && t.Arch == h.Arch
+}
+
+// Archs returns archs (GOARCH) which assets are suitable for the target
+func (t Target) Archs() []string {
+	if t.Rosetta && t.OS == "darwin" && t.Arch == "arm64" {
+		return []string{t.Arch, "amd64"}
+	}
+	return []string{t.Arch}
+}
+
+// ArchNames returns GOARCH and its aliases used in asset names
+// (amd64, x64, x86_64)
+func ArchNames(goarch string) []string {
+	res := []string{goarch}
+	for alias, arch := range archAliases {
+		if arch == goarch {
+			res = append(res, alias)
+		}
+	}
+	sort.Strings(res[1:])
+	return res
+}
+
+// AssetPlatforms returns platform names of protoc assets suitable for
+// the target in order of preference
+func (t Target) AssetPlatforms() []string {
+	var res []string
+	for _, arch := range t.Archs() {
+		res = append(res, assetPlatforms[t.OS+"/"+arch]...)
+	}
+	return res
+}
@@ -0,0 +1,462 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Plugin is a known protoc plugin
+type Plugin struct {
+	// Name is a name of the plugin executable
+	Name string
+	// Owner and Repo is a GitHub repository with releases of the plugin
+	// (empty if the plugin is only built from sources)
+	Owner, Repo string
+	// TagPrefix is a prefix of release tags ("v" for most repositories)
+	TagPrefix string
+	// Asset returns a name of the release asset for a tag, OS (GOOS) and
+	// arch (GOARCH or its alias used in assets, see ArchNames)
+	Asset func(tag, goos, arch string) string
+	// GoPackage is built with "go install" if there is no release asset
+	// for the current OS/arch
+	GoPackage string
+}
+
+// Plugins is a registry of known plugins
+var Plugins = []Plugin{
+	{
+		Name:      "protoc-gen-go",
+		Owner:     "protocolbuffers",
+		Repo:      "protobuf-go",
+		TagPrefix: "v",
+		Asset: func(tag, goos, arch string) string {
+			// protoc-gen-go.v1.25.0.linux.amd64.tar.gz
+			ext := ".tar.gz"
+			if goos == "windows" {
+				ext = ".zip"
+			}
+			return fmt.Sprintf("protoc-gen-go.%s.%s.%s%s", tag, goos, arch, ext)
+		},
+		GoPackage: "google.golang.org/protobuf/cmd/protoc-gen-go",
+	},
+	{
+		Name:      "protoc-gen-go-grpc",
+		GoPackage: "google.golang.org/grpc/cmd/protoc-gen-go-grpc",
+	},
+	{
+		Name:  "protoc-gen-grpc-web",
+		Owner: "grpc",
+		Repo:  "grpc-web",
+		Asset: func(tag, goos, arch string) string {
+			// protoc-gen-grpc-web-1.2.1-linux-x86_64, protoc-gen-grpc-web-1.4.2-linux-aarch64
+			return fmt.Sprintf("protoc-gen-grpc-web-%s-%s-%s%s", tag, goos, arch, exeSuffix(goos))
+		},
+	},
+	{
+		Name:      "protoc-gen-grpc-gateway",
+		Owner:     "grpc-ecosystem",
+		Repo:      "grpc-gateway",
+		TagPrefix: "v",
+		Asset: func(tag, goos, arch string) string {
+			// protoc-gen-grpc-gateway-v2.1.0-linux-x86_64, protoc-gen-grpc-gateway-v2.1.0-linux-arm64
+			return fmt.Sprintf("protoc-gen-grpc-gateway-%s-%s-%s%s", tag, goos, arch, exeSuffix(goos))
+		},
+		GoPackage: "github.com/grpc-ecosystem/grpc-gateway/v2/protoc-gen-grpc-gateway",
+	},
+	{
+		Name:      "protoc-gen-openapiv2",
+		Owner:     "grpc-ecosystem",
+		Repo:      "grpc-gateway",
+		TagPrefix: "v",
+		Asset: func(tag, goos, arch string) string {
+			// protoc-gen-openapiv2-v2.1.0-linux-x86_64
+			return fmt.Sprintf("protoc-gen-openapiv2-%s-%s-%s%s", tag, goos, arch, exeSuffix(goos))
+		},
+		GoPackage: "github.com/grpc-ecosystem/grpc-gateway/v2/protoc-gen-openapiv2",
+	},
+}
+
+func exeSuffix(goos string) string {
+	if goos == "windows" {
+		return ".exe"
+	}
+	return ""
+}
+
+// FindPlugin returns a known plugin by name
+func FindPlugin(name string) (*Plugin, error) {
+	for i := range Plugins {
+		if Plugins[i].Name == name {
+			return &Plugins[i], nil
+		}
+	}
+	return nil, NewError(ErrNotFound, "Plugin %s is not known (see \"plugin known\")", name)
+}
+
+// ParsePluginSpec parses "name@version" (version is "stable" if omitted)
+func ParsePluginSpec(spec string) (string, string) {
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		return spec[:i], spec[i+1:]
+	}
+	return spec, "stable"
+}
+
+// HasReleases returns true if the plugin is distributed as release assets
+func (p *Plugin) HasReleases() bool {
+	return p.Repo != "" && p.Asset != nil
+}
+
+// Tag returns a release tag for a version
+func (p *Plugin) Tag(version string) string {
+	return p.TagPrefix + strings.TrimPrefix(version, "v")
+}
+
+// PluginVersion returns a version of a plugin (as stored in plugins dir)
+// for a release tag or an exact version
+func PluginVersion(tag string) string {
+	return "v" + strings.TrimPrefix(tag, "v")
+}
+
+// FindAsset returns the plugin's release asset for the target
+func (p *Plugin) FindAsset(release *Release, t Target) *Asset {
+	if !p.HasReleases() {
+		return nil
+	}
+	for _, goarch := range t.Archs() {
+		for _, arch := range ArchNames(goarch) {
+			name := p.Asset(release.Tag, t.OS, arch)
+			for i, a := range release.Assets {
+				if a.Name == name {
+					return &release.Assets[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// PluginSourceSpec returns a release source spec (see NewReleaseSource) of
+// a plugin. Local directory keeps plugin releases in plugins/<name> subdir.
+func PluginSourceSpec(spec, name string) string {
+	switch {
+	case spec == "" || spec == "github",
+		strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return spec
+	}
+	return "file://" + filepath.Join(strings.TrimPrefix(spec, "file://"), "plugins", name)
+}
+
+// GetHomePluginsDir returns home's plugins dir for app
+func GetHomePluginsDir(app string) (string, error) {
+	home, err := GetHomeDir(app)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, "plugins"), nil
+}
+
+// GetHomePluginDir returns home's dir for a certain plugin version
+func GetHomePluginDir(app, name, version string) (string, error) {
+	plugins, err := GetHomePluginsDir(app)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(plugins, name, version), nil
+}
+
+// IsInstalledPlugin returns true (first result) if a plugin version is
+// installed
+func IsInstalledPlugin(app, name, version string) (bool, string, error) {
+	pluginDir, err := GetHomePluginDir(app, name, version)
+	if err != nil {
+		return false, "", err
+	}
+	_, err = os.Stat(filepath.Join(pluginDir, ManifestName))
+	if os.IsNotExist(err) {
+		return false, pluginDir, nil
+	}
+	return err == nil, pluginDir, err
+}
+
+// InstallPluginAsset installs a plugin version from a release asset (zip,
+// tar.gz or a bare executable). Returns (false, nil) if the version is
+// installed already.
+func InstallPluginAsset(ctx context.Context, app string, p *Plugin, version string, src ReleaseSource, asset Asset, opts InstallOptions, d func(ms ...interface{})) (bool, error) {
+	return installPlugin(app, p, version, opts, d, func(staging string, m *InstallManifest) error {
+		local, sum, err := fetchAsset(ctx, app, src, asset, opts, d)
+		if err != nil {
+			return err
+		}
+		m.Asset, m.URL, m.SHA256 = asset.Name, asset.URL, sum
+
+		d(" ... extracting ... ")
+		if err := extractPlugin(p.Name+exeSuffix(opts.target().OS), local, staging); err != nil {
+			// do not reuse a broken asset next time
+			os.Remove(local)
+			return err
+		}
+		return nil
+	})
+}
+
+// BuildPlugin installs a plugin version with "go install"
+func BuildPlugin(ctx context.Context, app string, p *Plugin, version string, opts InstallOptions, d func(ms ...interface{})) (bool, error) {
+	if p.GoPackage == "" {
+		return false, NewError(ErrNoAsset, "Plugin %s could not be built from sources", p.Name)
+	}
+	if !opts.target().IsHost() {
+		return false, NewError(ErrNoAsset, "Plugin %s could be built only for the host platform (not %s)",
+			p.Name, opts.target())
+	}
+	return installPlugin(app, p, version, opts, d, func(staging string, m *InstallManifest) error {
+		goBin, err := exec.LookPath("go")
+		if err != nil {
+			return fmt.Errorf("Go is required to build plugin %s: %v", p.Name, err)
+		}
+		pkg := p.GoPackage + "@" + version
+		m.URL = pkg
+
+		d(" ... building", pkg, "... ")
+		cmd := exec.CommandContext(ctx, goBin, "install", pkg)
+		// outside of any module, so the build is not affected by go.mod
+		cmd.Dir = staging
+		cmd.Env = SetEnv(os.Environ(), "GOBIN", filepath.Join(staging, "bin"))
+		cmd.Env = SetEnv(cmd.Env, "GO111MODULE", "on")
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("Build of %s failed: %v", pkg, err)
+		}
+		return nil
+	})
+}
+
+// installPlugin stages a plugin version (fill puts the executable into
+// staging/bin) and moves it into the plugins dir
+func installPlugin(app string, p *Plugin, version string, opts InstallOptions, d func(ms ...interface{}), fill func(staging string, m *InstallManifest) error) (bool, error) {
+	d(" ... preparing home ...")
+	if err := PrepareHomeDir(app); err != nil {
+		return false, err
+	}
+
+	d(" ... checking if installed ...")
+	installed, pluginDir, err := IsInstalledPlugin(app, p.Name, version)
+	if err != nil {
+		return false, err
+	}
+	if installed && !opts.Force {
+		d(" ... installed :)")
+		return false, nil
+	}
+
+	tmp, err := GetHomeTmpDir(app)
+	if err != nil {
+		return false, err
+	}
+	staging, err := ioutil.TempDir(tmp, p.Name+"-"+version+".staging-")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(staging)
+	if err := os.Chmod(staging, 0755); err != nil {
+		return false, err
+	}
+
+	manifest := InstallManifest{Version: version, Platform: opts.target().String()}
+	if err := fill(staging, &manifest); err != nil {
+		return false, err
+	}
+
+	exeName := p.Name + exeSuffix(opts.target().OS)
+	if _, err := os.Stat(filepath.Join(staging, "bin", exeName)); err != nil {
+		return false, fmt.Errorf("Plugin %s@%s is broken: %s is not found", p.Name, version, exeName)
+	}
+	manifest.InstalledAt = time.Now()
+	manifest.Files = []string{"bin/" + exeName}
+	if err := WriteManifest(staging, manifest); err != nil {
+		return false, err
+	}
+
+	d(" ... moving into plugins dir ... ")
+	if err := os.MkdirAll(filepath.Dir(pluginDir), 0755); err != nil {
+		return false, err
+	}
+	if err := replaceDir(staging, pluginDir, tmp); err != nil {
+		return false, err
+	}
+
+	d(" ... done. ")
+	return true, nil
+}
+
+// extractPlugin puts the plugin executable (exeName) from an asset into
+// dir/bin
+func extractPlugin(exeName, asset, dir string) error {
+	binDir := filepath.Join(dir, "bin")
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return err
+	}
+
+	var unpack func(string, string) ([]string, error)
+	switch {
+	case strings.HasSuffix(asset, ".zip"):
+		unpack = Unzip
+	case strings.HasSuffix(asset, ".tar.gz"), strings.HasSuffix(asset, ".tgz"):
+		unpack = Untar
+	default:
+		// a bare executable
+		return copyExecutable(asset, filepath.Join(binDir, exeName))
+	}
+
+	unpacked := filepath.Join(dir, "unpacked")
+	files, err := unpack(asset, unpacked)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(unpacked)
+	for _, f := range files {
+		if filepath.Base(f) == exeName {
+			return copyExecutable(f, filepath.Join(binDir, exeName))
+		}
+	}
+	return errors.New("Executable " + exeName + " is not found in " + filepath.Base(asset))
+}
+
+func copyExecutable(src, dst string) error {
+	return copyFile(src, dst, 0755)
+}
+
+// InstalledPlugin is an installed version of a plugin
+type InstalledPlugin struct {
+	Name    string
+	Version string
+	Date    time.Time
+	Active  bool
+	Path    string
+}
+
+// ListInstalledPlugins returns installed plugins (sorted by name, versions
+// in desc order)
+func ListInstalledPlugins(app string) ([]InstalledPlugin, error) {
+	pluginsDir, err := GetHomePluginsDir(app)
+	if err != nil {
+		return nil, err
+	}
+	names, err := ioutil.ReadDir(pluginsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	profile, err := GetActiveProfile(app)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []InstalledPlugin{}
+	for _, n := range names {
+		if !n.IsDir() {
+			continue
+		}
+		versions, err := ioutil.ReadDir(filepath.Join(pluginsDir, n.Name()))
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(versions, func(i, j int) bool {
+			return CompareTags(versions[i].Name(), versions[j].Name()) > 0
+		})
+		for _, v := range versions {
+			installed, dir, err := IsInstalledPlugin(app, n.Name(), v.Name())
+			if err != nil {
+				return nil, err
+			}
+			if !installed {
+				continue
+			}
+			res = append(res, InstalledPlugin{
+				Name:    n.Name(),
+				Version: v.Name(),
+				Date:    v.ModTime(),
+				Active:  profile.Plugins[n.Name()] == v.Name(),
+				Path:    dir,
+			})
+		}
+	}
+	return res, nil
+}
+
+// ActivatePlugin activates a plugin version (in addition to the active
+// protoc version and other plugins)
+func ActivatePlugin(app, name, version string) error {
+	p, err := GetActiveProfile(app)
+	if err != nil {
+		return err
+	}
+	p.Plugins[name] = version
+	return ActivateProfile(app, *p)
+}
+
+// DeactivatePlugin deactivates a plugin
+func DeactivatePlugin(app, name string) error {
+	p, err := GetActiveProfile(app)
+	if err != nil {
+		return err
+	}
+	delete(p.Plugins, name)
+	return ActivateProfile(app, *p)
+}
+
+// GetActivePlugin returns active version of a plugin ("" if the plugin is
+// not active)
+func GetActivePlugin(app, name string) (string, error) {
+	p, err := GetActiveProfile(app)
+	if err != nil {
+		return "", err
+	}
+	return p.Plugins[name], nil
+}
+
+// DeletePlugin deletes a plugin version
+func DeletePlugin(app, name, version string) error {
+	pluginDir, err := GetHomePluginDir(app, name, version)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(pluginDir); err != nil {
+		return err
+	}
+	// the plugin dir is removed with the last version
+	os.Remove(filepath.Dir(pluginDir))
+	return nil
+}
+
+// ResolveInstalledPlugin resolves a version constraint against installed
+// versions of a plugin
+func ResolveInstalledPlugin(app, name, constraint string) (string, error) {
+	plugins, err := ListInstalledPlugins(app)
+	if err != nil {
+		return "", err
+	}
+	versions := []string{}
+	for _, p := range plugins {
+		if p.Name == name {
+			versions = append(versions, p.Version)
+		}
+	}
+	version, err := ResolveConstraint(constraint, versions)
+	if errors.Is(err, ErrNotFound) {
+		return "", NewError(ErrNotInstalled, "Plugin %s@%s is not installed", name, constraint)
+	}
+	return version, err
+}
@@ -0,0 +1,63 @@
+package utils
+
+import "testing"
+
+func TestPluginFindAsset(t *testing.T) {
+	release := func(tag string, names ...string) *Release {
+		r := &Release{Tag: tag}
+		for _, name := range names {
+			r.Assets = append(r.Assets, Asset{Name: name})
+		}
+		return r
+	}
+	grpcWeb := release("1.4.2",
+		"protoc-gen-grpc-web-1.4.2-darwin-aarch64",
+		"protoc-gen-grpc-web-1.4.2-darwin-x86_64",
+		"protoc-gen-grpc-web-1.4.2-linux-aarch64",
+		"protoc-gen-grpc-web-1.4.2-linux-x86_64",
+		"protoc-gen-grpc-web-1.4.2-windows-x86_64.exe")
+	grpcWebOld := release("1.2.1",
+		"protoc-gen-grpc-web-1.2.1-darwin-x86_64",
+		"protoc-gen-grpc-web-1.2.1-linux-x86_64")
+	gateway := release("v2.1.0",
+		"protoc-gen-grpc-gateway-v2.1.0-darwin-arm64",
+		"protoc-gen-grpc-gateway-v2.1.0-linux-arm64",
+		"protoc-gen-grpc-gateway-v2.1.0-linux-x86_64",
+		"protoc-gen-grpc-gateway-v2.1.0-windows-x86_64.exe")
+	goGen := release("v1.25.0",
+		"protoc-gen-go.v1.25.0.linux.amd64.tar.gz",
+		"protoc-gen-go.v1.25.0.linux.arm64.tar.gz",
+		"protoc-gen-go.v1.25.0.windows.386.zip")
+
+	tests := []struct {
+		plugin  string
+		release *Release
+		target  Target
+		want    string
+	}{
+		{"protoc-gen-grpc-web", grpcWeb, Target{OS: "linux", Arch: "arm64"}, "protoc-gen-grpc-web-1.4.2-linux-aarch64"},
+		{"protoc-gen-grpc-web", grpcWeb, Target{OS: "linux", Arch: "amd64"}, "protoc-gen-grpc-web-1.4.2-linux-x86_64"},
+		{"protoc-gen-grpc-web", grpcWeb, Target{OS: "windows", Arch: "amd64"}, "protoc-gen-grpc-web-1.4.2-windows-x86_64.exe"},
+		{"protoc-gen-grpc-web", grpcWeb, Target{OS: "darwin", Arch: "arm64", Rosetta: true}, "protoc-gen-grpc-web-1.4.2-darwin-aarch64"},
+		{"protoc-gen-grpc-web", grpcWebOld, Target{OS: "darwin", Arch: "arm64", Rosetta: true}, "protoc-gen-grpc-web-1.2.1-darwin-x86_64"},
+		{"protoc-gen-grpc-web", grpcWebOld, Target{OS: "darwin", Arch: "arm64"}, ""},
+		{"protoc-gen-grpc-gateway", gateway, Target{OS: "linux", Arch: "arm64"}, "protoc-gen-grpc-gateway-v2.1.0-linux-arm64"},
+		{"protoc-gen-grpc-gateway", gateway, Target{OS: "windows", Arch: "amd64"}, "protoc-gen-grpc-gateway-v2.1.0-windows-x86_64.exe"},
+		{"protoc-gen-go", goGen, Target{OS: "linux", Arch: "amd64"}, "protoc-gen-go.v1.25.0.linux.amd64.tar.gz"},
+		{"protoc-gen-go", goGen, Target{OS: "windows", Arch: "386"}, "protoc-gen-go.v1.25.0.windows.386.zip"},
+		{"protoc-gen-go", goGen, Target{OS: "darwin", Arch: "amd64"}, ""},
+	}
+	for _, tt := range tests {
+		p, err := FindPlugin(tt.plugin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if a := p.FindAsset(tt.release, tt.target); a != nil {
+			got = a.Name
+		}
+		if got != tt.want {
+			t.Errorf("%s %s %s: got %q, want %q", tt.plugin, tt.release.Tag, tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ProfileFileName is a name of the file describing an activation profile
+const ProfileFileName = "profile.json"
+
+// Profile is a set of active protoc version and plugins.
+//
+// Without plugins the active dir is a symlink to the version dir. With
+// plugins it is a symlink to a profile dir (~/.<app>/profiles/<id>) which
+// contains bin dir with links to executables of the version and plugins,
+// include link and profile.json.
+type Profile struct {
+	Version string            `json:"version,omitempty"`
+	Plugins map[string]string `json:"plugins,omitempty"`
+}
+
+// GetHomeProfilesDir returns home's profiles dir for app
+func GetHomeProfilesDir(app string) (string, error) {
+	home, err := GetHomeDir(app)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, "profiles"), nil
+}
+
+// GetActiveProfile returns active profile (empty if nothing is active)
+func GetActiveProfile(app string) (*Profile, error) {
+	activeDir, err := GetHomeActiveDir(app)
+	if err != nil {
+		return nil, err
+	}
+	p := &Profile{Plugins: map[string]string{}}
+
+	if isDir(activeDir) {
+		// old layout: "/home/user/.pbvm/versions/v3.12.3/bin" -> "v3.12.3"
+		l, err := os.Readlink(filepath.Join(activeDir, "bin"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			p.Version = filepath.Base(filepath.Dir(l))
+		}
+		return p, nil
+	}
+
+	l, err := os.Readlink(activeDir)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Base(filepath.Dir(l)) == "versions" {
+		// "versions/v3.12.3" -> "v3.12.3"
+		p.Version = filepath.Base(l)
+		return p, nil
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(activeDir, ProfileFileName))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("Profile %s is broken: %v", l, err)
+	}
+	if p.Plugins == nil {
+		p.Plugins = map[string]string{}
+	}
+	return p, nil
+}
+
+// ActivateProfile makes the profile active. The active dir is switched
+// atomically (a new symlink is renamed over the old one), so bin and include
+// always belong to the same profile.
+func ActivateProfile(app string, p Profile) error {
+	home, err := GetHomeDir(app)
+	if err != nil {
+		return err
+	}
+	activeDir, err := GetHomeActiveDir(app)
+	if err != nil {
+		return err
+	}
+
+	if p.Version == "" && len(p.Plugins) == 0 {
+		// nothing is active
+		if err := os.RemoveAll(activeDir); err != nil {
+			return err
+		}
+		return cleanProfiles(app, "")
+	}
+
+	// relative links keep working if home dir is moved
+	target := filepath.Join("versions", p.Version)
+	if len(p.Plugins) > 0 {
+		dir, err := writeProfile(app, p)
+		if err != nil {
+			return err
+		}
+		target, err = filepath.Rel(home, dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	tmp := fmt.Sprintf("%s.tmp-%d", activeDir, os.Getpid())
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	err = os.Rename(tmp, activeDir)
+	if err != nil && isDir(activeDir) {
+		// old layout: active dir with bin and include symlinks
+		err = replaceDir(tmp, activeDir, home)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return cleanProfiles(app, target)
+}
+
+// writeProfile creates a new profile dir, returns its path
+func writeProfile(app string, p Profile) (string, error) {
+	profilesDir, err := GetHomeProfilesDir(app)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(profilesDir, 0755); err != nil {
+		return "", err
+	}
+	dir, err := ioutil.TempDir(profilesDir, "")
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chmod(dir, 0755); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	if err := fillProfile(app, dir, p); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// fillProfile creates bin links, include link and profile.json in dir
+// (links are relative: profiles/<id>/bin/<file> -> ../../../<target>)
+func fillProfile(app, dir string, p Profile) error {
+	binDir := filepath.Join(dir, "bin")
+	if err := os.Mkdir(binDir, 0755); err != nil {
+		return err
+	}
+	root := filepath.Join("..", "..", "..")
+
+	var bins []string
+	if p.Version != "" {
+		bins = append(bins, filepath.Join("versions", p.Version, "bin"))
+		include := filepath.Join("..", "..", "versions", p.Version, "include")
+		if err := os.Symlink(include, filepath.Join(dir, "include")); err != nil {
+			return err
+		}
+	}
+	names := make([]string, 0, len(p.Plugins))
+	for name := range p.Plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		bins = append(bins, filepath.Join("plugins", name, p.Plugins[name], "bin"))
+	}
+
+	home, err := GetHomeDir(app)
+	if err != nil {
+		return err
+	}
+	for _, bin := range bins {
+		files, err := ioutil.ReadDir(filepath.Join(home, bin))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			link := filepath.Join(binDir, f.Name())
+			if _, err := os.Lstat(link); err == nil {
+				// the first wins: protoc, then plugins
+				continue
+			}
+			if err := os.Symlink(filepath.Join(root, bin, f.Name()), link); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, ProfileFileName), data, 0644)
+}
+
+// cleanProfiles removes all profiles except the active one (target is
+// the target of the active link)
+func cleanProfiles(app, target string) error {
+	profilesDir, err := GetHomeProfilesDir(app)
+	if err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(profilesDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if filepath.Join("profiles", f.Name()) == target {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(profilesDir, f.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// lockHeader is written at the top of the project lock file
+const lockHeader = "# generated by %s sync, do not edit\n"
+
+// Project is a toolchain manifest of a project (<app>.yaml): protoc and
+// plugins versions (or constraints)
+type Project struct {
+	Protoc  string            `yaml:"protoc,omitempty"`
+	Plugins map[string]string `yaml:"plugins,omitempty"`
+}
+
+// LockedAsset is an asset of a locked tool
+type LockedAsset struct {
+	Name   string `yaml:"name"`
+	URL    string `yaml:"url,omitempty"`
+	SHA256 string `yaml:"sha256,omitempty"`
+}
+
+// LockedTool is a tool (protoc or a plugin) resolved by sync
+type LockedTool struct {
+	// Constraint is a version (constraint) from the manifest
+	Constraint string `yaml:"constraint"`
+	// Version is a resolved version
+	Version string `yaml:"version"`
+	// Assets are installed assets by platform (GOOS/GOARCH), plugins built
+	// from sources have no assets
+	Assets map[string]LockedAsset `yaml:"assets,omitempty"`
+}
+
+// ProjectLock is a lock file of a project (<app>.lock)
+type ProjectLock struct {
+	Protoc  *LockedTool            `yaml:"protoc,omitempty"`
+	Plugins map[string]*LockedTool `yaml:"plugins,omitempty"`
+}
+
+// GetProjectFileName returns a name of the project's toolchain manifest
+func GetProjectFileName(app string) string {
+	return app + ".yaml"
+}
+
+// GetProjectLockName returns a name of the project's lock file
+func GetProjectLockName(app string) string {
+	return app + ".lock"
+}
+
+// FindProject looks for a dir with the toolchain manifest walking up from
+// dir. Returns empty string if nothing is found.
+func FindProject(app, dir string) (string, error) {
+	return findUp(dir, GetProjectFileName(app))
+}
+
+// findUp looks for a dir with a file walking up from dir. Returns empty
+// string if nothing is found.
+func findUp(dir, name string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if err == nil {
+			return dir, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// ReadProject reads the toolchain manifest
+func ReadProject(file string) (*Project, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	p := &Project{}
+	if err := yaml.UnmarshalStrict(data, p); err != nil {
+		return nil, fmt.Errorf("Manifest %s is broken: %v", file, err)
+	}
+	return p, nil
+}
+
+// ReadProjectLock reads the lock file (an empty lock if the file does not
+// exist)
+func ReadProjectLock(file string) (*ProjectLock, error) {
+	l := &ProjectLock{}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("Lock file %s is broken: %v", file, err)
+	}
+	return l, nil
+}
+
+// WriteProjectLock writes the lock file
+func WriteProjectLock(app, file string, l *ProjectLock) error {
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	data = append([]byte(fmt.Sprintf(lockHeader, app)), data...)
+
+	tmp := fmt.Sprintf("%s.tmp-%d", file, os.Getpid())
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// LockChecksums is a checksum source backed by a locked tool
+type LockChecksums struct {
+	File string
+	Tool *LockedTool
+}
+
+// Checksum returns checksum for an asset from the lock
+func (c LockChecksums) Checksum(ctx context.Context, asset Asset) (string, error) {
+	if c.Tool == nil {
+		return "", nil
+	}
+	for _, a := range c.Tool.Assets {
+		if a.Name == asset.Name {
+			return normalizeChecksum(a.SHA256), nil
+		}
+	}
+	return "", nil
+}
+
+func (c LockChecksums) String() string {
+	return c.File
+}
+
+// readPinProject returns protoc version from the project's lock file or
+// manifest in dir (the lock wins)
+func readPinProject(app, dir string) (string, string, error) {
+	file := filepath.Join(dir, GetProjectLockName(app))
+	l, err := ReadProjectLock(file)
+	if err != nil {
+		return "", "", err
+	}
+	if l.Protoc != nil && l.Protoc.Version != "" {
+		return file, l.Protoc.Version, nil
+	}
+
+	file = filepath.Join(dir, GetProjectFileName(app))
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return "", "", nil
+	}
+	p, err := ReadProject(file)
+	if err != nil {
+		return "", "", err
+	}
+	return file, strings.TrimSpace(p.Protoc), nil
+}
+
+// FindProjectPlugin returns a version of a plugin set by the project in dir
+// (or its parents) and the file it is set in. A constraint from the manifest
+// is resolved against installed versions. Returns empty strings if the
+// project does not use the plugin.
+func FindProjectPlugin(app, dir, name string) (string, string, error) {
+	projectDir, err := FindProject(app, dir)
+	if err != nil || projectDir == "" {
+		return "", "", err
+	}
+
+	file := filepath.Join(projectDir, GetProjectLockName(app))
+	l, err := ReadProjectLock(file)
+	if err != nil {
+		return "", "", err
+	}
+	if t := l.Plugins[name]; t != nil && t.Version != "" {
+		return t.Version, file, nil
+	}
+
+	file = filepath.Join(projectDir, GetProjectFileName(app))
+	p, err := ReadProject(file)
+	if err != nil {
+		return "", "", err
+	}
+	constraint, ok := p.Plugins[name]
+	if !ok {
+		return "", "", nil
+	}
+	if constraint == "" {
+		constraint = "stable"
+	}
+	version, err := ResolveInstalledPlugin(app, name, constraint)
+	if err != nil {
+		return "", "", fmt.Errorf("%w (set by %s)", err, file)
+	}
+	return version, file, nil
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// RunCommand runs an executable with streamed stdin/stdout/stderr and
+// forwards interrupting signals to it (except ones sent by the terminal). Returns exit code of the command.
+func RunCommand(bin string, args, env []string) (int, error) {
+	command := exec.Command(bin, args...)
+	command.Env = env
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	if err := command.Start(); err != nil {
+		return 0, err
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	go func() {
+		for sig := range sigs {
+			// Ctrl-C and Ctrl-\ are sent by the terminal to the whole
+			// foreground group, the command has got them already
+			if (sig == os.Interrupt || sig == syscall.SIGQUIT) && inForeground() {
+				continue
+			}
+			// not all signals are supported on all platforms
+			command.Process.Signal(sig)
+		}
+	}()
+
+	err := command.Wait()
+	signal.Stop(sigs)
+	close(sigs)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Shells supported by env/shell/init commands
+const (
+	ShellBash       = "bash"
+	ShellZsh        = "zsh"
+	ShellFish       = "fish"
+	ShellPowerShell = "powershell"
+)
+
+// Shells are all supported shells
+var Shells = []string{ShellBash, ShellZsh, ShellFish, ShellPowerShell}
+
+// ParseShell returns a supported shell by its name (or a path to it).
+// Empty name means the current shell (see DetectShell).
+func ParseShell(name string) (string, error) {
+	if name == "" {
+		return DetectShell(), nil
+	}
+	base := strings.ToLower(filepath.Base(name))
+	base = strings.TrimSuffix(base, ".exe")
+	switch base {
+	case ShellBash, ShellZsh, ShellFish, ShellPowerShell:
+		return base, nil
+	case "sh", "ksh", "dash":
+		return ShellBash, nil
+	case "pwsh":
+		return ShellPowerShell, nil
+	}
+	return "", errors.New("Shell " + name + " is not supported (expected one of: " +
+		strings.Join(Shells, ", ") + ")")
+}
+
+// DetectShell returns the current shell by $SHELL (bash if it is unknown,
+// powershell on Windows)
+func DetectShell() string {
+	if env := os.Getenv("SHELL"); env != "" {
+		if sh, err := ParseShell(env); err == nil {
+			return sh
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return ShellPowerShell
+	}
+	return ShellBash
+}
+
+// ExportEnv returns a shell command setting an env variable
+func ExportEnv(shell, key, value string) string {
+	switch shell {
+	case ShellFish:
+		return "set -gx " + key + " " + QuoteShell(shell, value) + ";"
+	case ShellPowerShell:
+		return "$env:" + key + " = " + QuoteShell(shell, value)
+	}
+	return "export " + key + "=" + QuoteShell(shell, value)
+}
+
+// UnsetEnv returns a shell command removing an env variable
+func UnsetEnv(shell, key string) string {
+	switch shell {
+	case ShellFish:
+		return "set -e " + key + ";"
+	case ShellPowerShell:
+		return "Remove-Item Env:" + key + " -ErrorAction SilentlyContinue"
+	}
+	return "unset " + key
+}
+
+// ExportPath returns a shell command setting PATH to dirs
+func ExportPath(shell string, dirs []string) string {
+	if shell != ShellFish {
+		return ExportEnv(shell, "PATH", strings.Join(dirs, string(os.PathListSeparator)))
+	}
+	// PATH is a list in fish
+	quoted := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		quoted = append(quoted, QuoteShell(shell, dir))
+	}
+	return "set -gx PATH " + strings.Join(quoted, " ") + ";"
+}
+
+// QuoteShell quotes a string for a shell (single quotes)
+func QuoteShell(shell, s string) string {
+	switch shell {
+	case ShellFish:
+		s = strings.Replace(s, `\`, `\\`, -1)
+		return "'" + strings.Replace(s, "'", `\'`, -1) + "'"
+	case ShellPowerShell:
+		return "'" + strings.Replace(s, "'", "''", -1) + "'"
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// ShellVersionEnv returns shell commands setting a version for the current
+// shell: ShellHookEnv and <APP>_VERSION (which outranks pinned versions).
+func ShellVersionEnv(app, version, shell string) ([]string, error) {
+	lines, err := ShellHookEnv(app, version, shell)
+	if err != nil {
+		return nil, err
+	}
+	return append(lines, ExportEnv(shell, GetVersionEnvName(app), version)), nil
+}
+
+// ShellHookEnv returns shell commands switching protoc of the current shell
+// to a version (empty version removes it): PATH (bin dirs of other versions
+// are removed), PROTOC and PROTOC_INCLUDE. Unlike ShellVersionEnv
+// <APP>_VERSION is not changed, so a version set by the user is kept.
+func ShellHookEnv(app, version, shell string) ([]string, error) {
+	versionsDir, err := GetHomeVersionsDir(app)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := []string{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir != "" && !isInside(versionsDir, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	if version == "" {
+		return []string{
+			ExportPath(shell, dirs),
+			UnsetEnv(shell, EnvProtoc),
+			UnsetEnv(shell, EnvProtocInclude),
+		}, nil
+	}
+
+	versionDir, err := GetHomeVersionDir(app, version)
+	if err != nil {
+		return nil, err
+	}
+	protoc, err := GetProtocPath(app, version)
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		ExportPath(shell, append([]string{filepath.Join(versionDir, "bin")}, dirs...)),
+		ExportEnv(shell, EnvProtoc, protoc),
+		ExportEnv(shell, EnvProtocInclude, filepath.Join(versionDir, "include")),
+	}, nil
+}
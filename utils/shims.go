@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// ShimCommand is a (hidden) command used by shims to run a real executable
+const ShimCommand = "shim-exec"
+
+const shimMarker = "generated by pbvm, do not edit"
+
+// ListShimNames returns names of executables found in bin dirs of all
+// installed versions and installed plugins ("protoc" is always included)
+func ListShimNames(app string) ([]string, error) {
+	versionsDir, err := GetHomeVersionsDir(app)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{"protoc": true}
+	versions, err := ioutil.ReadDir(versionsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, v := range versions {
+		if !v.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(versionsDir, v.Name(), "bin"))
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			if f.IsDir() {
+				continue
+			}
+			names[strings.TrimSuffix(f.Name(), ".exe")] = true
+		}
+	}
+
+	// plugins are run by protoc, so they are needed in PATH too
+	plugins, err := ListInstalledPlugins(app)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range plugins {
+		names[p.Name] = true
+	}
+
+	res := make([]string, 0, len(names))
+	for n := range names {
+		res = append(res, n)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// WriteShims (re)creates shims for all known executables. A shim calls
+// "<self> shim-exec <name> <args>", where self is a path to the app binary.
+// Files without the shim marker are kept (and not overwritten). Returns paths
+// of the written shims.
+func WriteShims(app, self string) ([]string, error) {
+	if err := PrepareHomeDir(app); err != nil {
+		return nil, err
+	}
+	shimsDir, err := GetHomeShimsDir(app)
+	if err != nil {
+		return nil, err
+	}
+	names, err := ListShimNames(app)
+	if err != nil {
+		return nil, err
+	}
+
+	// remove stale shims, files of the user are kept
+	files, err := ioutil.ReadDir(shimsDir)
+	if err != nil {
+		return nil, err
+	}
+	userFiles := map[string]bool{}
+	for _, f := range files {
+		file := filepath.Join(shimsDir, f.Name())
+		if f.IsDir() || !isShim(file) {
+			userFiles[f.Name()] = true
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return nil, err
+		}
+	}
+
+	res := []string{}
+	for _, name := range names {
+		file, content := shimScript(shimsDir, name, self)
+		if userFiles[filepath.Base(file)] {
+			continue
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0755); err != nil {
+			return nil, err
+		}
+		res = append(res, file)
+	}
+	return res, nil
+}
+
+func shimScript(dir, name, self string) (string, string) {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(dir, name+".cmd"), fmt.Sprintf(
+			"@echo off\r\nrem %s\r\n\"%s\" %s %s %%*\r\n", shimMarker, self, ShimCommand, name)
+	}
+	return filepath.Join(dir, name), fmt.Sprintf(
+		"#!/bin/sh\n# %s\nexec '%s' %s %s \"$@\"\n",
+		shimMarker, strings.Replace(self, "'", `'\''`, -1), ShimCommand, name)
+}
+
+// isShim returns true if a file is a shim generated by WriteShims
+func isShim(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	return bytes.Contains(head[:n], []byte(shimMarker))
+}
+
+// ResolveShim returns a version and a path to the real executable which should
+// be run by the shim in the current directory (see ResolveVersion). For
+// a plugin (set by the project, see FindProjectPlugin, or active) the version
+// is empty.
+func ResolveShim(app, name string) (string, string, error) {
+	plugin, err := resolvePlugin(app, name)
+	if err != nil {
+		return "", "", err
+	}
+	if plugin != "" {
+		pluginDir, err := GetHomePluginDir(app, name, plugin)
+		if err != nil {
+			return "", "", err
+		}
+		bin := filepath.Join(pluginDir, "bin", GetExecutableName(name))
+		if !isExecutable(bin) {
+			return "", "", NewError(ErrNotInstalled, "Plugin %s@%s is not installed", name, plugin)
+		}
+		return "", bin, nil
+	}
+
+	version, origin, err := ResolveVersion(app, "")
+	if err != nil {
+		return "", "", err
+	}
+
+	installed, versionDir, err := IsInstalledVersion(app, version)
+	if err != nil {
+		return "", "", err
+	}
+	if !installed {
+		return "", "", NewError(ErrNotInstalled, "Version %s (set by %s) is not installed", version, origin)
+	}
+
+	bin := filepath.Join(versionDir, "bin", GetExecutableName(name))
+	if !isExecutable(bin) {
+		return "", "", errors.New("Command " + name + " is not found in version " + version)
+	}
+	return version, bin, nil
+}
+
+// resolvePlugin returns a version of a plugin used in the current directory
+// ("" if name is not a plugin or it is not used)
+func resolvePlugin(app, name string) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	version, _, err := FindProjectPlugin(app, cwd, name)
+	if err != nil || version != "" {
+		return version, err
+	}
+	return GetActivePlugin(app, name)
+}
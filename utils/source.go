@@ -0,0 +1,435 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// Release describes a release of the Protocol Buffers
+type Release struct {
+	Tag         string
+	Name        string
+	Prerelease  bool
+	PublishedAt time.Time
+	URL         string
+	Notes       string
+	Assets      []Asset
+}
+
+// Asset describes a downloadable file of a release
+type Asset struct {
+	ID   int64
+	Name string
+	Size int
+	URL  string
+}
+
+// ReleaseSource is a place where releases could be found and downloaded from
+// (GitHub, an internal mirror, a local directory, etc)
+type ReleaseSource interface {
+	// ListReleases returns a page of releases (newest first), pages start from 1
+	ListReleases(ctx context.Context, page, perPage int) ([]Release, error)
+	// GetReleaseByTag returns a release by its tag
+	GetReleaseByTag(ctx context.Context, tag string) (*Release, error)
+	// ListAssets returns all assets of a release
+	ListAssets(ctx context.Context, tag string) ([]Asset, error)
+	// OpenAsset returns a stream with the content of an asset starting
+	// from the offset (to resume interrupted downloads)
+	OpenAsset(ctx context.Context, asset Asset, offset int64) (io.ReadCloser, error)
+}
+
+// SourceOptions are options of a release source
+type SourceOptions struct {
+	// APIClient is used for API requests (DownloadClient if nil)
+	APIClient *http.Client
+	// DownloadClient is used to download assets (http.DefaultClient if nil)
+	DownloadClient *http.Client
+	// Authenticated should be true if clients use a token (see TokenTransport)
+	Authenticated bool
+	// MaxRateLimitWait is a max time to wait for GitHub API rate limit reset
+	// (0 - fail right away)
+	MaxRateLimitWait time.Duration
+}
+
+func (o SourceOptions) download() *http.Client {
+	if o.DownloadClient == nil {
+		return http.DefaultClient
+	}
+	return o.DownloadClient
+}
+
+func (o SourceOptions) api() *http.Client {
+	if o.APIClient == nil {
+		return o.download()
+	}
+	return o.APIClient
+}
+
+// NewReleaseSource creates a release source by its spec:
+//
+//   - "" or "github" - public GitHub
+//   - "http(s)://host/..." - GitHub (Enterprise) compatible API
+//   - "file:///path" or an existing dir ("/path", "./path") - local
+//     directory (see DirSource)
+func NewReleaseSource(spec, owner, repo string, opts SourceOptions) (ReleaseSource, error) {
+	switch {
+	case spec == "" || spec == "github":
+		return NewGitHubSource(owner, repo, opts), nil
+	case strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://"):
+		return NewGitHubEnterpriseSource(spec, owner, repo, opts)
+	case strings.HasPrefix(spec, "file://"):
+		return NewDirSource(strings.TrimPrefix(spec, "file://"))
+	}
+	if st, err := os.Stat(spec); err == nil && st.IsDir() {
+		return NewDirSource(spec)
+	}
+	return nil, NewError(ErrInvalid, "Release source %q is unknown (expected "+
+		"\"github\", http(s)://<GitHub compatible API>, file://<dir> or an existing dir)", spec)
+}
+
+// releasesPerPage is a page size used to fetch all releases
+const releasesPerPage = 100
+
+// WalkReleases calls fn for each release of a source (fetching page by page)
+// until fn returns false or there are no more releases
+func WalkReleases(ctx context.Context, src ReleaseSource, fn func(r Release) bool) error {
+	for page := 1; ; page++ {
+		releases, err := src.ListReleases(ctx, page, releasesPerPage)
+		if err != nil {
+			return err
+		}
+		for _, r := range releases {
+			if !fn(r) {
+				return nil
+			}
+		}
+		if len(releases) < releasesPerPage {
+			return nil
+		}
+	}
+}
+
+// ListAllReleases returns all releases of a source
+func ListAllReleases(ctx context.Context, src ReleaseSource) ([]Release, error) {
+	res := []Release{}
+	err := WalkReleases(ctx, src, func(r Release) bool {
+		res = append(res, r)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GitHubSource is a release source backed by GitHub releases
+type GitHubSource struct {
+	client   *github.Client
+	download *http.Client
+	owner    string
+	repo     string
+	opts     SourceOptions
+}
+
+// NewGitHubSource returns a source for releases of the owner/repo on GitHub
+func NewGitHubSource(owner, repo string, opts SourceOptions) *GitHubSource {
+	return &GitHubSource{
+		client:   github.NewClient(opts.api()),
+		download: opts.download(),
+		owner:    owner,
+		repo:     repo,
+		opts:     opts,
+	}
+}
+
+// NewGitHubEnterpriseSource returns a source for releases of the owner/repo on
+// GitHub Enterprise (or any mirror with GitHub compatible API)
+func NewGitHubEnterpriseSource(baseURL, owner, repo string, opts SourceOptions) (*GitHubSource, error) {
+	gh, err := github.NewEnterpriseClient(baseURL, baseURL, opts.api())
+	if err != nil {
+		return nil, err
+	}
+	return &GitHubSource{
+		client:   gh,
+		download: opts.download(),
+		owner:    owner,
+		repo:     repo,
+		opts:     opts,
+	}, nil
+}
+
+// ListReleases returns a page of releases
+func (g *GitHubSource) ListReleases(ctx context.Context, page, perPage int) ([]Release, error) {
+	opts := &github.ListOptions{Page: page, PerPage: perPage}
+	var releases []*github.RepositoryRelease
+	err := g.retry(ctx, func() (err error) {
+		releases, _, err = g.client.Repositories.ListReleases(ctx, g.owner, g.repo, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Release, 0, len(releases))
+	for _, r := range releases {
+		res = append(res, fromGitHubRelease(r))
+	}
+	return res, nil
+}
+
+// GetReleaseByTag returns a release by its tag
+func (g *GitHubSource) GetReleaseByTag(ctx context.Context, tag string) (*Release, error) {
+	var release *github.RepositoryRelease
+	err := g.retry(ctx, func() (err error) {
+		release, _, err = g.client.Repositories.GetReleaseByTag(ctx, g.owner, g.repo, tag)
+		return err
+	})
+	if errors.Is(err, ErrOffline) {
+		// the release could be in cached list of releases
+		return g.findRelease(ctx, tag, err)
+	}
+	var respErr *github.ErrorResponse
+	if errors.As(err, &respErr) && respErr.Response.StatusCode == http.StatusNotFound {
+		return nil, NewError(ErrNotFound, "Release %s is not found", tag)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := fromGitHubRelease(release)
+	return &r, nil
+}
+
+// retry calls fn and retries it if rate limit is exceeded (see SourceOptions)
+func (g *GitHubSource) retry(ctx context.Context, fn func() error) error {
+	return retryRateLimit(ctx, g.opts.MaxRateLimitWait, g.opts.Authenticated, fn)
+}
+
+// findRelease looks for a release in the list of releases, returns notFound
+// error if there is no such release
+func (g *GitHubSource) findRelease(ctx context.Context, tag string, notFound error) (*Release, error) {
+	var found *Release
+	err := WalkReleases(ctx, g, func(r Release) bool {
+		if r.Tag == tag {
+			found = &r
+		}
+		return found == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, notFound
+	}
+	return found, nil
+}
+
+// ListAssets returns all assets of a release
+func (g *GitHubSource) ListAssets(ctx context.Context, tag string) ([]Asset, error) {
+	release, err := g.GetReleaseByTag(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	return release.Assets, nil
+}
+
+// OpenAsset downloads an asset
+func (g *GitHubSource) OpenAsset(ctx context.Context, asset Asset, offset int64) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, asset.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := g.download.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		size, _ := contentRangeSize(resp.Header.Get("Content-Range"))
+		return &sizedBody{ReadCloser: resp.Body, size: size}, nil
+	case resp.StatusCode == http.StatusOK && offset > 0:
+		// range is not supported, skip already downloaded part
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		return &sizedBody{ReadCloser: resp.Body, size: resp.ContentLength}, nil
+	case resp.StatusCode == http.StatusOK:
+		return &sizedBody{ReadCloser: resp.Body, size: resp.ContentLength}, nil
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		if size, ok := contentRangeSize(resp.Header.Get("Content-Range")); ok && size == offset {
+			// downloaded completely already
+			resp.Body.Close()
+			return &sizedBody{ReadCloser: ioutil.NopCloser(strings.NewReader("")), size: size}, nil
+		}
+	}
+	resp.Body.Close()
+	return nil, &HTTPError{URL: asset.URL, StatusCode: resp.StatusCode, Status: resp.Status}
+}
+
+func fromGitHubRelease(r *github.RepositoryRelease) Release {
+	res := Release{
+		Tag:        r.GetTagName(),
+		Name:       r.GetName(),
+		Prerelease: r.GetPrerelease(),
+		URL:        r.GetHTMLURL(),
+		Notes:      r.GetBody(),
+	}
+	if r.PublishedAt != nil {
+		res.PublishedAt = r.PublishedAt.Time
+	}
+	for _, a := range r.Assets {
+		res.Assets = append(res.Assets, Asset{
+			ID:   a.GetID(),
+			Name: a.GetName(),
+			Size: a.GetSize(),
+			URL:  a.GetBrowserDownloadURL(),
+		})
+	}
+	return res
+}
+
+// DirSource is a release source backed by a local directory with
+// the following layout:
+//
+//	<root>/<tag>/<asset>
+//
+// A tag with a pre-release suffix (v4.0.0-rc1) is treated as a pre-release.
+type DirSource struct {
+	root string
+}
+
+// NewDirSource returns a source for releases stored in a local directory
+func NewDirSource(root string) (*DirSource, error) {
+	st, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !st.IsDir() {
+		return nil, errors.New("Release source is not a directory: " + root)
+	}
+	return &DirSource{root: root}, nil
+}
+
+// ListReleases returns a page of releases
+func (s *DirSource) ListReleases(ctx context.Context, page, perPage int) ([]Release, error) {
+	files, err := ioutil.ReadDir(s.root)
+	if err != nil {
+		return nil, err
+	}
+
+	// Desc order by version
+	sort.SliceStable(files, func(i, j int) bool {
+		return CompareTags(files[i].Name(), files[j].Name()) > 0
+	})
+	res := []Release{}
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		r, err := s.GetReleaseByTag(ctx, f.Name())
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *r)
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	from := (page - 1) * perPage
+	if from >= len(res) {
+		return nil, nil
+	}
+	to := from + perPage
+	if perPage <= 0 || to > len(res) {
+		to = len(res)
+	}
+	return res[from:to], nil
+}
+
+// tagDir returns a dir of a release, tags escaping the root are rejected
+func (s *DirSource) tagDir(tag string) (string, error) {
+	if tag == "" || tag == "." || strings.Contains(tag, "..") || strings.ContainsAny(tag, `/\`) {
+		return "", fmt.Errorf("Invalid release tag: %q", tag)
+	}
+	return filepath.Join(s.root, tag), nil
+}
+
+// GetReleaseByTag returns a release by its tag
+func (s *DirSource) GetReleaseByTag(ctx context.Context, tag string) (*Release, error) {
+	dir, err := s.tagDir(tag)
+	if err != nil {
+		return nil, err
+	}
+	st, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return nil, NewError(ErrNotFound, "Release %s is not found", tag)
+	}
+	if err != nil {
+		return nil, err
+	}
+	assets, err := s.ListAssets(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	v, err := ParseVersion(tag)
+	return &Release{
+		Tag:         tag,
+		Name:        tag,
+		Prerelease:  err == nil && v.IsPrerelease(),
+		PublishedAt: st.ModTime(),
+		URL:         dir,
+		Assets:      assets,
+	}, nil
+}
+
+// ListAssets returns all assets of a release
+func (s *DirSource) ListAssets(ctx context.Context, tag string) ([]Asset, error) {
+	dir, err := s.tagDir(tag)
+	if err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	res := []Asset{}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		res = append(res, Asset{
+			Name: f.Name(),
+			Size: int(f.Size()),
+			URL:  filepath.Join(dir, f.Name()),
+		})
+	}
+	return res, nil
+}
+
+// OpenAsset opens an asset file
+func (s *DirSource) OpenAsset(ctx context.Context, asset Asset, offset int64) (io.ReadCloser, error) {
+	f, err := os.Open(asset.URL)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,244 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeSource is an in-memory release source, releases are newest first
+type fakeSource struct {
+	releases []Release
+	content  map[string][]byte
+	// calls counts ListReleases calls
+	calls int
+}
+
+// newFakeSource returns a source with releases of tags (newest first),
+// each release has a single linux-x86_64 asset
+func newFakeSource(tags ...string) *fakeSource {
+	s := &fakeSource{content: map[string][]byte{}}
+	for _, tag := range tags {
+		v, err := ParseVersion(tag)
+		name := "protoc-" + tag[1:] + "-linux-x86_64.zip"
+		url := "mem://" + tag + "/" + name
+		s.content[url] = []byte("zip of " + tag)
+		s.releases = append(s.releases, Release{
+			Tag:        tag,
+			Name:       tag,
+			Prerelease: err == nil && v.IsPrerelease(),
+			Assets:     []Asset{{Name: name, Size: len(s.content[url]), URL: url}},
+		})
+	}
+	return s
+}
+
+func (s *fakeSource) ListReleases(ctx context.Context, page, perPage int) ([]Release, error) {
+	s.calls++
+	from := (page - 1) * perPage
+	if from >= len(s.releases) {
+		return nil, nil
+	}
+	to := from + perPage
+	if to > len(s.releases) {
+		to = len(s.releases)
+	}
+	return s.releases[from:to], nil
+}
+
+func (s *fakeSource) GetReleaseByTag(ctx context.Context, tag string) (*Release, error) {
+	for _, r := range s.releases {
+		if r.Tag == tag {
+			r := r
+			return &r, nil
+		}
+	}
+	return nil, NewError(ErrNotFound, "Release %s is not found", tag)
+}
+
+func (s *fakeSource) ListAssets(ctx context.Context, tag string) ([]Asset, error) {
+	r, err := s.GetReleaseByTag(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	return r.Assets, nil
+}
+
+func (s *fakeSource) OpenAsset(ctx context.Context, asset Asset, offset int64) (io.ReadCloser, error) {
+	data, ok := s.content[asset.URL]
+	if !ok {
+		return nil, fmt.Errorf("Asset %s is not found", asset.URL)
+	}
+	return ioutil.NopCloser(bytes.NewReader(data[offset:])), nil
+}
+
+func TestListAllReleases(t *testing.T) {
+	tags := []string{}
+	for i := 250; i > 0; i-- {
+		tags = append(tags, fmt.Sprintf("v3.%d.0", i))
+	}
+	src := newFakeSource(tags...)
+
+	releases, err := ListAllReleases(context.Background(), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != len(tags) {
+		t.Errorf("got %d releases, want %d", len(releases), len(tags))
+	}
+	if src.calls != 3 {
+		t.Errorf("got %d pages requested, want 3", src.calls)
+	}
+
+	src.calls = 0
+	n := 0
+	err = WalkReleases(context.Background(), src, func(r Release) bool {
+		n++
+		return r.Tag != "v3.240.0"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 11 || src.calls != 1 {
+		t.Errorf("walk stopped after %d releases and %d pages, want 11 and 1", n, src.calls)
+	}
+}
+
+func TestNewReleaseSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pbvm-source-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		spec string
+		dir  bool
+		err  bool
+	}{
+		{spec: ""},
+		{spec: "github"},
+		{spec: "https://ghe.example.com/api/v3/"},
+		{spec: dir, dir: true},
+		{spec: "file://" + dir, dir: true},
+		{spec: "githb", err: true},
+		{spec: "gitub", err: true},
+		{spec: filepath.Join(dir, "missing"), err: true},
+		{spec: "file://" + filepath.Join(dir, "missing"), err: true},
+	}
+	for _, tt := range tests {
+		src, err := NewReleaseSource(tt.spec, "owner", "repo", SourceOptions{})
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.spec, err)
+			continue
+		}
+		if _, ok := src.(*DirSource); ok != tt.dir {
+			t.Errorf("%q: got %T", tt.spec, src)
+		}
+	}
+
+	if _, err := NewReleaseSource("githb", "owner", "repo", SourceOptions{}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("githb: got %v, want ErrInvalid", err)
+	}
+}
+
+func TestDirSource(t *testing.T) {
+	root, err := ioutil.TempDir("", "pbvm-source-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"v3.12.3/protoc-3.12.3-linux-x86_64.zip":        "3.12.3",
+		"v3.9.0/protoc-3.9.0-linux-x86_64.zip":          "3.9.0",
+		"v4.0.0-rc1/protoc-4.0.0-rc-1-linux-x86_64.zip": "rc1",
+	}
+	for name, content := range files {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+
+	src, err := NewDirSource(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releases, err := ListAllReleases(ctx, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := []string{}
+	for _, r := range releases {
+		tags = append(tags, r.Tag)
+		if r.Prerelease != (r.Tag == "v4.0.0-rc1") {
+			t.Errorf("%s: prerelease is %v", r.Tag, r.Prerelease)
+		}
+	}
+	if want := []string{"v4.0.0-rc1", "v3.12.3", "v3.9.0"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("got releases %v, want %v", tags, want)
+	}
+
+	r, err := src.GetReleaseByTag(ctx, "v3.12.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Assets) != 1 || r.Assets[0].Size != len("3.12.3") {
+		t.Fatalf("got assets %+v", r.Assets)
+	}
+	rc, err := src.OpenAsset(ctx, r.Assets[0], 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(data) != "12.3" {
+		t.Errorf("got content %q (%v), want %q", data, err, "12.3")
+	}
+
+	if _, err := src.GetReleaseByTag(ctx, "v1.0.0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("v1.0.0: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestDirSourceInvalidTag(t *testing.T) {
+	root, err := ioutil.TempDir("", "pbvm-source-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.MkdirAll(filepath.Join(root, "rel", "v3.12.3"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	src, err := NewDirSource(filepath.Join(root, "rel"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tag := range []string{"", ".", "..", "../rel", "../../x", "v3/../v3.12.3", `..\x`, "a/b"} {
+		if _, err := src.GetReleaseByTag(context.Background(), tag); err == nil {
+			t.Errorf("GetReleaseByTag(%q): expected an error", tag)
+		}
+		if _, err := src.ListAssets(context.Background(), tag); err == nil {
+			t.Errorf("ListAssets(%q): expected an error", tag)
+		}
+	}
+}
@@ -1,51 +1,32 @@
 package utils
 
 import (
+	"archive/tar"
 	"archive/zip"
+	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"path"
 	"path/filepath"
-	"runtime"
 	"sort"
 	"strings"
 	"time"
-
-	"github.com/google/go-github/v32/github"
 )
 
-var archs = map[string]string{
-	"386":   "x86_32",
-	"amd64": "x86_64",
-}
-
-// GetArch returns current arch
-func GetArch() string {
-	arch, ok := archs[runtime.GOARCH]
-	if ok {
-		return arch
-	}
-	return runtime.GOARCH
-}
-
-// IsSuitableAsset returns true if asset is suitable for download for current system
-func IsSuitableAsset(assetName, arch, os string) bool {
-	return strings.HasPrefix(assetName, "protoc") &&
-		strings.Contains(assetName, fmt.Sprintf("-%s-", os)) &&
-		strings.Contains(assetName, fmt.Sprintf("-%s.", arch))
+// IsSuitableAsset returns true if asset is a protoc archive for the platform
+// (platform name as used in assets, see Target.AssetPlatforms)
+func IsSuitableAsset(assetName, platform string) bool {
+	return strings.HasPrefix(assetName, "protoc-") &&
+		strings.HasSuffix(assetName, "-"+platform+".zip")
 }
 
-// GetHomeDir returns home dir for app
+// GetHomeDir returns home dir for app (see SetHome)
 func GetHomeDir(app string) (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
-	}
-
-	return path.Join(home, "."+app), nil
+	home, _, _, err := homeDirs(app)
+	return home, err
 }
 
 // GetHomeVersionsDir returns home's versions dir for app
@@ -78,7 +59,18 @@ func GetHomeTmpDir(app string) (string, error) {
 	return path.Join(home, "tmp"), nil
 }
 
-// GetHomeActiveDir returns home's active dir for app
+// GetHomeChecksumsFile returns home's checksums database for app
+func GetHomeChecksumsFile(app string) (string, error) {
+	home, err := GetHomeDir(app)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(home, "checksums.txt"), nil
+}
+
+// GetHomeActiveDir returns home's active dir for app (a symlink to the
+// active version dir)
 func GetHomeActiveDir(app string) (string, error) {
 	home, err := GetHomeDir(app)
 	if err != nil {
@@ -88,13 +80,29 @@ func GetHomeActiveDir(app string) (string, error) {
 	return path.Join(home, "active"), nil
 }
 
+// GetHomeCacheDir returns home's cache dir for app (release metadata)
+func GetHomeCacheDir(app string) (string, error) {
+	_, cache, _, err := homeDirs(app)
+	return cache, err
+}
+
+// GetHomeShimsDir returns home's shims dir for app
+func GetHomeShimsDir(app string) (string, error) {
+	home, err := GetHomeDir(app)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(home, "shims"), nil
+}
+
 // PrepareHomeDir prepares home dir
 func PrepareHomeDir(app string) error {
 	fs := []func(string) (string, error){
 		GetHomeDir,
 		GetHomeTmpDir,
 		GetHomeVersionsDir,
-		GetHomeActiveDir,
+		GetHomeShimsDir,
 	}
 	for _, f := range fs {
 		d, err := f(app)
@@ -108,25 +116,6 @@ func PrepareHomeDir(app string) error {
 	return nil
 }
 
-// DownloadFile will download a url to a local file. (it will
-// write as it downloads and not load the whole file into memory)
-func DownloadFile(url, filepath string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, resp.Body)
-	return err
-}
-
 // Unzip will decompress a zip archive, moving all files and folders
 // within the zip file (parameter 1) to an output directory (parameter 2).
 func Unzip(src string, dest string) ([]string, error) {
@@ -185,63 +174,257 @@ func Unzip(src string, dest string) ([]string, error) {
 	return filenames, nil
 }
 
+// Untar will decompress a tar.gz archive, moving all files and folders
+// within the archive (parameter 1) to an output directory (parameter 2).
+func Untar(src string, dest string) ([]string, error) {
+
+	var filenames []string
+
+	f, err := os.Open(src)
+	if err != nil {
+		return filenames, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return filenames, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return filenames, err
+		}
+
+		fpath := filepath.Join(dest, h.Name)
+
+		// Check for ZipSlip (the same applies to tar)
+		if !strings.HasPrefix(fpath, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return filenames, fmt.Errorf("%s: illegal file path", fpath)
+		}
+
+		switch h.Typeflag {
+		case tar.TypeDir:
+			filenames = append(filenames, fpath)
+			os.MkdirAll(fpath, os.ModePerm)
+			continue
+		case tar.TypeReg, tar.TypeRegA:
+		default:
+			// links and special files are not needed
+			continue
+		}
+		filenames = append(filenames, fpath)
+
+		if err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+			return filenames, err
+		}
+
+		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(h.Mode).Perm())
+		if err != nil {
+			return filenames, err
+		}
+
+		_, err = io.Copy(outFile, tr)
+		outFile.Close()
+
+		if err != nil {
+			return filenames, err
+		}
+	}
+	return filenames, nil
+}
+
+// InstallOptions are options of a version installation
+type InstallOptions struct {
+	// Checksum is an expected SHA-256 of the release archive (optional)
+	Checksum string
+	// Downloader is used to download the release archive
+	Downloader *Downloader
+	// Force reinstalls already installed version (the archive is
+	// downloaded again)
+	Force bool
+	// Target is a platform of the installed binaries (zero value is the
+	// host), binaries of other platforms are not validated
+	Target Target
+}
+
+// target returns the install target (the host if it is not set)
+func (o InstallOptions) target() Target {
+	if o.Target.OS == "" {
+		return HostTarget()
+	}
+	return o.Target
+}
+
 // DownloadVersion download a version if needed. Returns (false, nil) if version
-// is already downloaded
-func DownloadVersion(app, version string, asset *github.ReleaseAsset, d func(ms ...interface{})) (bool, error) {
+// is already downloaded. If checksum is set, then the downloaded (or
+// previously cached) zip is verified and removed on mismatch.
+//
+// The archive is unzipped into a staging dir, validated and only then
+// renamed into the versions dir, so an interrupted install never looks
+// like an installed version.
+func DownloadVersion(ctx context.Context, app, version string, src ReleaseSource, asset Asset, opts InstallOptions, d func(ms ...interface{})) (bool, error) {
 	d(" ... preparing home ...")
 	if err := PrepareHomeDir(app); err != nil {
 		return false, err
 	}
 
 	d(" ... checking if installed ...")
-	installed, versionDir, err := IsInstalledVersion(app, version)
+	state, versionDir, err := GetInstallState(app, version)
 	if err != nil {
 		return false, err
 	}
-
-	if !installed {
+	if state == Installed && !opts.Force {
+		d(" ... installed :)")
+		return false, nil
+	}
+	if state == PartiallyInstalled {
+		d(" ... partially installed, repairing :(")
+	} else {
 		d(" ... not installed :(")
-		tmp, err := GetHomeTmpDir(app)
-		if err != nil {
-			return false, err
-		}
-		zipLocal := path.Join(tmp, *asset.Name)
-		d(" ... checking if zip already downloaded ...")
-		if _, err := os.Stat(zipLocal); os.IsNotExist(err) {
-			d(" ... zip was not downloaded yet :( downloading ")
-			if err := DownloadFile(*asset.BrowserDownloadURL, zipLocal); err != nil {
-				return false, err
-			}
-		} else {
-			d(" ... zip was downloaded already :) ")
+	}
+
+	zipLocal, sum, err := fetchAsset(ctx, app, src, asset, opts, d)
+	if err != nil {
+		return false, err
+	}
+
+	tmp, err := GetHomeTmpDir(app)
+	if err != nil {
+		return false, err
+	}
+	staging, err := ioutil.TempDir(tmp, version+".staging-")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(staging)
+	if err := os.Chmod(staging, 0755); err != nil {
+		return false, err
+	}
+
+	d(" ... unzipping ... ")
+	files, err := Unzip(zipLocal, staging)
+	if err != nil {
+		// do not reuse a broken zip next time
+		os.Remove(zipLocal)
+		return false, err
+	}
+
+	if target := opts.target(); target.IsHost() {
+		d(" ... validating ... ")
+		if err := ValidateInstall(staging, version); err != nil {
+			os.Remove(zipLocal)
+			return false, fmt.Errorf("Version %s is broken: %v", version, err)
 		}
+	} else {
+		d(" ... not validated, binaries are for", target)
+	}
 
-		d(" ... unzipping ... ")
-		if _, err = Unzip(zipLocal, versionDir); err != nil {
-			return false, err
+	manifest := InstallManifest{
+		Version:     version,
+		Platform:    opts.target().String(),
+		Asset:       asset.Name,
+		URL:         asset.URL,
+		SHA256:      sum,
+		InstalledAt: time.Now(),
+	}
+	for _, f := range files {
+		if rel, err := filepath.Rel(staging, f); err == nil {
+			manifest.Files = append(manifest.Files, filepath.ToSlash(rel))
 		}
+	}
+	if err := WriteManifest(staging, manifest); err != nil {
+		return false, err
+	}
 
-		d(" ... done. ")
-		return true, nil
-	} else {
-		d(" ... installed :)")
+	d(" ... moving into versions dir ... ")
+	if err := replaceDir(staging, versionDir, tmp); err != nil {
+		return false, err
 	}
 
-	return false, nil
+	d(" ... done. ")
+	return true, nil
 }
 
-// IsInstalledVersion returns true (first result) if version is installed
-func IsInstalledVersion(app, version string) (bool, string, error) {
-	versionDir, err := GetHomeVersionDir(app, version)
+// fetchAsset downloads an asset into tmp dir (if it is not downloaded yet)
+// and verifies its checksum. Returns path to the file and its SHA-256.
+func fetchAsset(ctx context.Context, app string, src ReleaseSource, asset Asset, opts InstallOptions, d func(ms ...interface{})) (string, string, error) {
+	tmp, err := GetHomeTmpDir(app)
 	if err != nil {
-		return false, versionDir, err
+		return "", "", err
+	}
+	local := path.Join(tmp, asset.Name)
+	if opts.Force {
+		os.Remove(local)
+	}
+	d(" ... checking if asset already downloaded ...")
+	if _, err := os.Stat(local); os.IsNotExist(err) {
+		d(" ... asset was not downloaded yet :( downloading ")
+		dl := opts.Downloader
+		if dl == nil {
+			dl = NewDownloader()
+		}
+		if err := dl.Download(ctx, src, asset, local); err != nil {
+			return "", "", err
+		}
+	} else {
+		d(" ... asset was downloaded already :) ")
 	}
 
-	if _, err := os.Stat(versionDir); os.IsNotExist(err) {
-		return false, versionDir, nil
+	sum, err := FileSHA256(local)
+	if err != nil {
+		return "", "", err
 	}
+	if opts.Checksum != "" {
+		d(" ... verifying checksum ... ")
+		if err := VerifySHA256(local, opts.Checksum); err != nil {
+			os.Remove(local)
+			return "", "", err
+		}
+	} else {
+		// upstream releases publish no sums, so it is the common case
+		fmt.Fprintf(os.Stderr, "Warning: checksum of %s is not known, it is not verified (sha256: %s).\n"+
+			"Pass --sha256 or add it to the checksums file, --require-checksum fails instead.\n",
+			asset.Name, sum)
+	}
+	return local, sum, nil
+}
 
-	return true, versionDir, nil
+// replaceDir renames src into dst. An existing dst is moved aside into tmp
+// and restored if the rename fails.
+func replaceDir(src, dst, tmp string) error {
+	if _, err := os.Lstat(dst); os.IsNotExist(err) {
+		return os.Rename(src, dst)
+	}
+
+	old, err := ioutil.TempDir(tmp, filepath.Base(dst)+".old-")
+	if err != nil {
+		return err
+	}
+	trash := filepath.Join(old, "dir")
+	if err := os.Rename(dst, trash); err != nil {
+		os.RemoveAll(old)
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		os.Rename(trash, dst)
+		os.RemoveAll(old)
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// IsInstalledVersion returns true (first result) if version is installed
+// (partially installed versions are not treated as installed)
+func IsInstalledVersion(app, version string) (bool, string, error) {
+	state, versionDir, err := GetInstallState(app, version)
+	return state == Installed, versionDir, err
 }
 
 // InstalledVersion describes installed version
@@ -249,6 +432,9 @@ type InstalledVersion struct {
 	Version string
 	Date    time.Time
 	Active  bool
+	Path    string
+	// Partial is true for interrupted installs (see GetInstallState)
+	Partial bool
 }
 
 // ListInstalledVersions returns a slice of installed versions
@@ -267,8 +453,10 @@ func ListInstalledVersions(app string) ([]InstalledVersion, error) {
 		return nil, err
 	}
 
-	// Desc order by name
-	sort.Slice(files, func(i, j int) bool { return files[i].Name() > files[j].Name() })
+	// Desc order by version
+	sort.SliceStable(files, func(i, j int) bool {
+		return CompareTags(files[i].Name(), files[j].Name()) > 0
+	})
 	res := []InstalledVersion{}
 	for _, f := range files {
 		if !f.IsDir() {
@@ -278,46 +466,45 @@ func ListInstalledVersions(app string) ([]InstalledVersion, error) {
 		if err != nil {
 			return nil, err
 		}
+		state, _, err := GetInstallState(app, f.Name())
+		if err != nil {
+			return nil, err
+		}
 		res = append(res, InstalledVersion{
 			Version: f.Name(),
 			Date:    f.ModTime(),
 			Active:  active,
+			Path:    path.Join(versionsDir, f.Name()),
+			Partial: state == PartiallyInstalled,
 		})
 	}
 
 	return res, nil
 }
 
-// ActivateVersion activates certain version
+// ActivateVersion activates version (active plugins stay active, see
+// ActivateProfile)
 func ActivateVersion(app, version string) error {
-
-	versionDir, err := GetHomeVersionDir(app, version)
-	if err != nil {
-		return err
-	}
-
-	activeDir, err := GetHomeActiveDir(app)
+	p, err := GetActiveProfile(app)
 	if err != nil {
 		return err
 	}
+	p.Version = version
+	return ActivateProfile(app, *p)
+}
 
-	dirs := []string{"bin", "include"}
-	for _, d := range dirs {
-		v := path.Join(versionDir, d)
-		l := path.Join(activeDir, d)
-		if _, err := os.Lstat(l); err == nil {
-			os.Remove(l)
-		}
-		if err := os.Symlink(v, l); err != nil {
-			return err
-		}
-	}
-	return nil
+// isDir returns true if path is a directory (not a symlink)
+func isDir(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.IsDir()
 }
 
 // IsActiveVersion returns bool if version is active
 func IsActiveVersion(app, version string) (bool, error) {
 	activeVer, err := GetActiveVersion(app)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
 	if err != nil {
 		return false, err
 	}
@@ -331,28 +518,24 @@ func IsActiveVersion(app, version string) (bool, error) {
 
 // GetActiveVersion returns active version
 func GetActiveVersion(app string) (string, error) {
-	activeDir, err := GetHomeActiveDir(app)
+	p, err := GetActiveProfile(app)
 	if err != nil {
 		return "", err
 	}
-
-	l, err := os.Readlink(path.Join(activeDir, "bin"))
-	if err != nil {
-		return "", err
+	if p.Version == "" {
+		return "", os.ErrNotExist
 	}
-	// converting
-	// "/home/user/.pbvm/versions/v3.12.3/bin" -> "v3.12.3"
-	return path.Base(path.Dir(l)), nil
+	return p.Version, nil
 }
 
-// FilterAsset finds an asset which is need to be downloaded
-func FilterAsset(release *github.RepositoryRelease) *github.ReleaseAsset {
-	arch := GetArch()
-	for _, a := range release.Assets {
-		if !IsSuitableAsset(*a.Name, arch, runtime.GOOS) {
-			continue
+// FilterAsset finds an asset which is need to be downloaded for the target
+func FilterAsset(assets []Asset, t Target) *Asset {
+	for _, platform := range t.AssetPlatforms() {
+		for i, a := range assets {
+			if IsSuitableAsset(a.Name, platform) {
+				return &assets[i]
+			}
 		}
-		return a
 	}
 	return nil
 }
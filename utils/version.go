@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var versionRe = regexp.MustCompile(`^v?(\d+)(?:\.(\d+|[xX*]))?(?:\.(\d+|[xX*]))?(?:-(.+))?$`)
+
+// Version is a parsed version (tag) of the Protocol Buffers, for example:
+// v3.12.3, v4.0.0-rc1, v21.1, v22.0-rc3, v3.0.0-alpha-3
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	Pre   string
+	// Parts is a number of numeric parts set explicitly (1-3)
+	Parts int
+	// Original is the string the version was parsed from
+	Original string
+}
+
+// ParseVersion parses a version (tag)
+func ParseVersion(s string) (Version, error) {
+	v, wildcard, err := parseVersion(s)
+	if err != nil {
+		return v, err
+	}
+	if wildcard {
+		return v, errors.New("Version is incorrect: " + s)
+	}
+	return v, nil
+}
+
+// parseVersion parses a version which could contain wildcards (3.x, 3.12.*)
+// and returns true if it does
+func parseVersion(s string) (Version, bool, error) {
+	m := versionRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Version{}, false, errors.New("Version is incorrect: " + s)
+	}
+
+	v := Version{Pre: m[4], Original: s}
+	wildcard := false
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range m[1:4] {
+		if part == "" {
+			break
+		}
+		if wildcard || part == "x" || part == "X" || part == "*" {
+			wildcard = true
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return Version{}, false, errors.New("Version is incorrect: " + s)
+		}
+		*nums[i] = n
+		v.Parts = i + 1
+	}
+	if wildcard && v.Pre != "" {
+		return Version{}, false, errors.New("Version is incorrect: " + s)
+	}
+	return v, wildcard, nil
+}
+
+// IsPrerelease returns true for versions like v4.0.0-rc1
+func (v Version) IsPrerelease() bool {
+	return v.Pre != ""
+}
+
+func (v Version) String() string {
+	return v.Original
+}
+
+// Compare returns -1, 0 or 1 if v is less, equal or greater than o
+func (v Version) Compare(o Version) int {
+	if c := compareInts(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareInts(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareInts(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+	// a release is greater than its pre-releases
+	switch {
+	case v.Pre == o.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case o.Pre == "":
+		return -1
+	}
+	return comparePre(v.Pre, o.Pre)
+}
+
+// Less returns true if v is less than o
+func (v Version) Less(o Version) bool {
+	return v.Compare(o) < 0
+}
+
+// CompareTags compares two version tags. Tags which could not be parsed are
+// less than any version and compared as strings.
+func CompareTags(a, b string) int {
+	av, aErr := ParseVersion(a)
+	bv, bErr := ParseVersion(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		if c := av.Compare(bv); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	case aErr == nil:
+		return 1
+	case bErr == nil:
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+// SortTags sorts version tags, the newest first
+func SortTags(tags []string) {
+	sort.SliceStable(tags, func(i, j int) bool { return CompareTags(tags[i], tags[j]) > 0 })
+}
+
+// SortReleases sorts releases by version, the newest first
+func SortReleases(releases []Release) {
+	sort.SliceStable(releases, func(i, j int) bool {
+		return CompareTags(releases[i].Tag, releases[j].Tag) > 0
+	})
+}
+
+// normalize converts 3.21+ versions into the new versioning scheme
+// (protobuf switched from v3.20.x to v21.x)
+func (v Version) normalize() Version {
+	if v.Major == 3 && v.Minor >= 21 && v.Parts >= 2 {
+		v.Major, v.Minor, v.Patch = v.Minor, v.Patch, 0
+		v.Parts--
+	}
+	return v
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+var preChunkRe = regexp.MustCompile(`\d+|[^\d.\-_]+`)
+
+// comparePre compares pre-release parts (alpha-3, beta-1, rc1, rc10)
+// chunk by chunk, numeric chunks are compared as numbers
+func comparePre(a, b string) int {
+	ac := preChunkRe.FindAllString(strings.ToLower(a), -1)
+	bc := preChunkRe.FindAllString(strings.ToLower(b), -1)
+	for i := 0; i < len(ac) && i < len(bc); i++ {
+		an, aErr := strconv.Atoi(ac[i])
+		bn, bErr := strconv.Atoi(bc[i])
+		var c int
+		switch {
+		case aErr == nil && bErr == nil:
+			c = compareInts(an, bn)
+		case aErr == nil:
+			c = -1
+		case bErr == nil:
+			c = 1
+		default:
+			c = strings.Compare(ac[i], bc[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(ac), len(bc))
+}
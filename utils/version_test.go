@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Version
+		err  bool
+	}{
+		{s: "v3.12.3", want: Version{Major: 3, Minor: 12, Patch: 3, Parts: 3}},
+		{s: "3.12.3", want: Version{Major: 3, Minor: 12, Patch: 3, Parts: 3}},
+		{s: "v4.0.0-rc1", want: Version{Major: 4, Pre: "rc1", Parts: 3}},
+		{s: "v21.1", want: Version{Major: 21, Minor: 1, Parts: 2}},
+		{s: "v22.0-rc3", want: Version{Major: 22, Pre: "rc3", Parts: 2}},
+		{s: "v3.0.0-alpha-3", want: Version{Major: 3, Pre: "alpha-3", Parts: 3}},
+		{s: "3", want: Version{Major: 3, Parts: 1}},
+		{s: "3.x", err: true},
+		{s: "3.12.*", err: true},
+		{s: "latest", err: true},
+		{s: "", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.s)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.s)
+			}
+			continue
+		}
+		tt.want.Original = tt.s
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %+v (%v), want %+v", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestCompareTags(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v3.12.3", "v3.12.3", 0},
+		{"v3.12.10", "v3.12.9", 1},
+		{"v3.9.0", "v3.12.0", -1},
+		{"v21.1", "v3.20.3", 1},
+		{"v4.0.0", "v4.0.0-rc1", 1},
+		{"v4.0.0-rc2", "v4.0.0-rc10", -1},
+		{"v3.0.0-alpha-3", "v3.0.0-beta-1", -1},
+		{"v3.0.0-beta-1", "v3.0.0-alpha-3", 1},
+		{"v22.0-rc1", "v21.12", 1},
+		{"plugins", "v3.5.0", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareTags(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareTags(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSortTags(t *testing.T) {
+	tags := []string{"v3.9.0", "v21.1", "v3.12.3", "v4.0.0-rc1", "v3.20.3", "v21.12", "v3.12.10"}
+	SortTags(tags)
+	want := []string{"v21.12", "v21.1", "v4.0.0-rc1", "v3.20.3", "v3.12.10", "v3.12.3", "v3.9.0"}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("got %v, want %v", tags, want)
+	}
+}